@@ -0,0 +1,211 @@
+package docopt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+abbreviations resolves commands in argv that are abbreviated to a unique
+prefix, for Parser.AbbreviateCommands.
+
+It walks the positional elements of argv through the pattern, keeping the set
+of places in the pattern the elements seen so far can lead to. At each element
+it collects the commands that may come next; an element that is not one of
+them but is a prefix of exactly one is recorded as an abbreviation of it. An
+element that is a prefix of several is recorded as ambiguous. Both are only
+hints for the matcher: the element may still be taken as an argument.
+*/
+type abbreviations struct {
+	fold      func(string) string
+	commands  map[int]string   // argv index to the command it abbreviates
+	ambiguous map[int][]string // argv index to the commands it may abbreviate
+
+	optional map[*pattern][]*pattern // cached Optional wrappers of children
+	repeat   map[*pattern]*pattern   // cached [child...] for OneOrMore
+	steps    int
+	maxSteps int
+}
+
+// abbrevStep is a leaf that may consume the next positional element,
+// together with the stack of patterns left to match after it.
+type abbrevStep struct {
+	leaf *pattern
+	rest []*pattern
+}
+
+// resolveAbbreviations resolves the abbreviations of argv against pat. It
+// fails with a LimitError after maxSteps steps, if maxSteps is positive.
+func resolveAbbreviations(pat *pattern, argv patternList, fold func(string) string, maxSteps int) (*abbreviations, error) {
+	a := &abbreviations{
+		fold:      fold,
+		commands:  make(map[int]string),
+		ambiguous: make(map[int][]string),
+		optional:  make(map[*pattern][]*pattern),
+		repeat:    make(map[*pattern]*pattern),
+		maxSteps:  maxSteps,
+	}
+	states := [][]*pattern{{pat}}
+	for i, arg := range argv {
+		if arg.t&patternArgument == 0 {
+			continue
+		}
+		value, ok := arg.value.(string)
+		if !ok || len(states) == 0 {
+			break
+		}
+		steps := []abbrevStep{}
+		seen := make(map[string]bool)
+		for _, state := range states {
+			a.expand(state, &steps, seen)
+		}
+		if a.maxSteps > 0 && a.steps > a.maxSteps {
+			return nil, newLimitError("Steps", "resolving abbreviations took more than %d steps", a.maxSteps)
+		}
+
+		exact := false
+		candidates := []string{}
+		for _, s := range steps {
+			if s.leaf.t&patternCommand == 0 {
+				continue
+			}
+			if a.same(value, s.leaf.name) {
+				exact = true
+			} else if strings.HasPrefix(a.key(s.leaf.name), a.key(value)) && value != "" {
+				candidates = appendUnique(candidates, s.leaf.name)
+			}
+		}
+		if !exact && len(candidates) == 1 {
+			a.commands[i] = candidates[0]
+		} else if !exact && len(candidates) > 1 {
+			sort.Strings(candidates)
+			a.ambiguous[i] = candidates
+		}
+
+		states = states[:0]
+		next := make(map[string]bool)
+		for _, s := range steps {
+			if s.leaf.t&patternArgument != 0 || a.same(value, s.leaf.name) || a.commands[i] == s.leaf.name {
+				if key := stackKey(s.rest); !next[key] {
+					next[key] = true
+					states = append(states, s.rest)
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+// expand appends to steps every leaf that may consume the next positional
+// element from state, a stack of patterns with the next one on top.
+func (a *abbreviations) expand(state []*pattern, steps *[]abbrevStep, seen map[string]bool) {
+	if len(state) == 0 {
+		return
+	}
+	a.steps++
+	if a.maxSteps > 0 && a.steps > a.maxSteps {
+		return
+	}
+	key := stackKey(state)
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+	top, rest := state[len(state)-1], state[:len(state)-1]
+	push := func(ps ...*pattern) []*pattern {
+		result := make([]*pattern, len(rest), len(rest)+len(ps))
+		copy(result, rest)
+		return append(result, ps...)
+	}
+	switch {
+	case top.t&(patternArgument|patternCommand) != 0:
+		*steps = append(*steps, abbrevStep{top, rest})
+	case top.t&patternOption != 0:
+		a.expand(rest, steps, seen)
+	case top.t&patternRequired != 0:
+		a.expand(push(reversed(top.children)...), steps, seen)
+	case top.t&(patternOptionAL|patternOptionSSHORTCUT) != 0:
+		if len(top.children) == 1 {
+			a.expand(rest, steps, seen)
+			a.expand(push(top.children[0]), steps, seen)
+		} else {
+			a.expand(push(reversed(a.optionalChildren(top))...), steps, seen)
+		}
+	case top.t&patternEither != 0:
+		for _, child := range top.children {
+			a.expand(push(child), steps, seen)
+		}
+	case top.t&patternOneOrMore != 0:
+		a.expand(push(a.repeated(top), top.children[0]), steps, seen)
+	}
+}
+
+// optionalChildren returns each child of p wrapped in its own Optional.
+func (a *abbreviations) optionalChildren(p *pattern) []*pattern {
+	if _, ok := a.optional[p]; !ok {
+		for _, child := range p.children {
+			a.optional[p] = append(a.optional[p], newOptional(child))
+		}
+	}
+	return a.optional[p]
+}
+
+// repeated returns [p] for the OneOrMore p, to match its further repetitions.
+func (a *abbreviations) repeated(p *pattern) *pattern {
+	if _, ok := a.repeat[p]; !ok {
+		a.repeat[p] = newOptional(p)
+	}
+	return a.repeat[p]
+}
+
+func (a *abbreviations) key(s string) string {
+	if a.fold != nil {
+		return a.fold(s)
+	}
+	return s
+}
+
+func (a *abbreviations) same(value, name string) bool {
+	return value == name || a.fold != nil && a.fold(value) == a.fold(name)
+}
+
+// err returns the error to report when argv did not match, if an ambiguous
+// abbreviation may be the reason.
+func (a *abbreviations) err(argv patternList) error {
+	indexes := []int{}
+	for i := range a.ambiguous {
+		indexes = append(indexes, i)
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+	sort.Ints(indexes)
+	i := indexes[0]
+	return newUserError("%s is not a unique prefix: %s?", argv[i].value, strings.Join(a.ambiguous[i], ", "))
+}
+
+func stackKey(stack []*pattern) string {
+	parts := make([]string, len(stack))
+	for i, p := range stack {
+		parts[i] = fmt.Sprintf("%p", p)
+	}
+	return strings.Join(parts, " ")
+}
+
+func reversed(pl []*pattern) []*pattern {
+	result := make([]*pattern, len(pl))
+	for i, p := range pl {
+		result[len(pl)-1-i] = p
+	}
+	return result
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,93 @@
+package docopt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const navalFate = `Naval Fate.
+
+Usage:
+  naval_fate ship new <name>...
+  naval_fate ship <name> move <x> <y> [--speed=<kn>]
+  naval_fate ship shoot <x> <y>
+  naval_fate mine (set|remove) <x> <y> [--moored|--drifting]
+  naval_fate -h | --help
+  naval_fate --version
+
+Options:
+  -h --help     Show this screen.
+  --version     Show version.
+  --speed=<kn>  Speed in knots [default: 10].
+  --moored      Moored (anchored) mine.
+  --drifting    Drifting mine.`
+
+func TestAbbreviateCommands(t *testing.T) {
+	p := &Parser{AbbreviateCommands: true}
+	v, err := p.ParseArgs(navalFate, []string{"sh", "n", "Foo"})
+	if err != nil || v["ship"] != true || v["new"] != true || !reflect.DeepEqual(v["<name>"], []string{"Foo"}) {
+		t.Error(v, err)
+	}
+
+	v, err = p.ParseArgs(navalFate, []string{"s", "Guardian", "mo", "1", "2"})
+	if err != nil || v["ship"] != true || v["move"] != true || !reflect.DeepEqual(v["<name>"], []string{"Guardian"}) {
+		t.Error(v, err)
+	}
+
+	v, err = p.ParseArgs(navalFate, []string{"m", "r", "1", "2", "--dr"})
+	if err != nil || v["mine"] != true || v["remove"] != true || v["--drifting"] != true {
+		t.Error(v, err)
+	}
+
+	// shoot is not valid after mine, so "s" is unique there
+	v, err = p.ParseArgs(navalFate, []string{"mi", "s", "1", "2"})
+	if err != nil || v["mine"] != true || v["set"] != true {
+		t.Error(v, err)
+	}
+
+	_, err = (&Parser{}).ParseArgs(navalFate, []string{"sh", "n", "Foo"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+}
+
+func TestAbbreviateCommandsAmbiguous(t *testing.T) {
+	p := &Parser{AbbreviateCommands: true}
+	_, err := p.ParseArgs("Usage: prog (start | stop | status)", []string{"st"})
+	if _, ok := err.(*UserError); !ok || !strings.Contains(err.Error(), "start, status, stop") {
+		t.Error(err)
+	}
+	v, err := p.ParseArgs("Usage: prog (start | stop | status)", []string{"sto"})
+	if reflect.DeepEqual(v, map[string]interface{}{"start": false, "stop": true, "status": false}) != true {
+		t.Error(err)
+	}
+
+	// an ambiguous prefix may still be an argument
+	v, err = p.ParseArgs("Usage: prog (start | stop | <file>)", []string{"st"})
+	if reflect.DeepEqual(v, map[string]interface{}{"start": false, "stop": false, "<file>": "st"}) != true {
+		t.Error(err)
+	}
+
+	p.CaseInsensitive = true
+	v, err = p.ParseArgs("Usage: prog remote (add | remove) <name>...", []string{"REM", "ADD", "a", "b"})
+	if err != nil || v["remote"] != true || v["add"] != true {
+		t.Error(v, err)
+	}
+}
+
+func TestAbbreviateCommandsLimit(t *testing.T) {
+	c, err := (&Parser{}).compile(navalFate, DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argv := patternList{newArgument("", "sh"), newArgument("", "n"), newArgument("", "Foo")}
+	if _, err := resolveAbbreviations(c.pat, argv, nil, 3); err == nil {
+		t.Error("no error past the step limit")
+	} else if e, ok := err.(*LimitError); !ok || e.Limit != "Steps" {
+		t.Error(err)
+	}
+	if a, err := resolveAbbreviations(c.pat, argv, nil, 0); err != nil || a.commands[0] != "ship" || a.commands[1] != "new" {
+		t.Error(a, err)
+	}
+}
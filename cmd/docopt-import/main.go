@@ -0,0 +1,44 @@
+/*
+Docopt-import drafts a docopt doc from the `--help` output of a program or
+its man page.
+
+It prints the draft, and what it could not translate to stderr.
+
+Usage:
+
+	ls --help | docopt-import
+	man cp | docopt-import
+	docopt-import help.txt
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/docopt/docopt-go"
+)
+
+func main() {
+	in := io.Reader(os.Stdin)
+	if len(os.Args) > 1 {
+		f, err := os.Open(os.Args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	text, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	doc, notes := docopt.ImportHelp(string(text))
+	fmt.Print(doc)
+	for _, note := range notes {
+		fmt.Fprintln(os.Stderr, "docopt-import:", note)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/docopt/docopt-go"
+)
+
+// doc is a docopt doc in a Go source file.
+type doc struct {
+	text  string // the value of the string literal
+	start int    // offset of the literal in the file
+	raw   bool   // a raw string, so text starts at start+1 and is verbatim
+}
+
+// parseFuncs are the functions and methods that take a doc first.
+var parseFuncs = map[string]bool{"Parse": true, "ParseArgs": true, "Check": true, "Describe": true}
+
+// findDocs returns the docs of a Go source file, as far as it parses.
+func findDocs(src string) []doc {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", src, 0)
+	if f == nil {
+		return nil
+	}
+	// string constants and variables, by name
+	values := map[string]*ast.BasicLit{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			for i, name := range n.Names {
+				if i < len(n.Values) {
+					if lit, ok := n.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						values[name.Name] = lit
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				name, ok := lhs.(*ast.Ident)
+				if ok && i < len(n.Rhs) {
+					if lit, ok := n.Rhs[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						values[name.Name] = lit
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	docs := []doc{}
+	seen := map[*ast.BasicLit]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !parseFuncs[sel.Sel.Name] {
+			return true
+		}
+		var lit *ast.BasicLit
+		switch arg := call.Args[0].(type) {
+		case *ast.BasicLit:
+			if arg.Kind == token.STRING {
+				lit = arg
+			}
+		case *ast.Ident:
+			lit = values[arg.Name]
+		}
+		if lit == nil || seen[lit] {
+			return true
+		}
+		seen[lit] = true
+		text, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		docs = append(docs, doc{text, fset.Position(lit.Pos()).Offset, lit.Value[0] == '`'})
+		return true
+	})
+	return docs
+}
+
+// offset returns the offset in the doc text of an offset in the file.
+func (d doc) offset(fileOffset int) (int, bool) {
+	if !d.raw || fileOffset <= d.start || fileOffset > d.start+1+len(d.text) {
+		return 0, false
+	}
+	return fileOffset - d.start - 1, true
+}
+
+// fileOffset returns the offset in the file of an offset in the doc text, or
+// the start of the literal if the doc is not a raw string.
+func (d doc) fileOffset(offset int) int {
+	if !d.raw {
+		return d.start
+	}
+	return d.start + 1 + offset
+}
+
+// diagnostics reports the errors in the docs of a Go source file.
+func diagnostics(src string) []diagnostic {
+	diags := []diagnostic{}
+	for _, d := range findDocs(src) {
+		err := (&docopt.Parser{}).Check(d.text)
+		if err == nil {
+			continue
+		}
+		start, end := errorSpan(d.text, err)
+		diags = append(diags, diagnostic{
+			Range:    span{pos(src, d.fileOffset(start)), pos(src, d.fileOffset(end))},
+			Severity: 1,
+			Source:   "docopt",
+			Message:  err.Error(),
+		})
+	}
+	return diags
+}
+
+// errorSpan returns where in doc an error is: the token at the line and
+// column of a LanguageError, the whole line if it has no column, or else the
+// first line of doc.
+func errorSpan(doc string, err error) (int, int) {
+	line, column := 1, 0
+	if e, ok := err.(*docopt.LanguageError); ok && e.File == "" && e.Line > 0 {
+		line, column = e.Line, e.Column
+	}
+	start := 0
+	for i := 1; i < line; i++ {
+		n := strings.IndexByte(doc[start:], '\n')
+		if n < 0 {
+			break
+		}
+		start += n + 1
+	}
+	end := strings.IndexByte(doc[start:], '\n')
+	if end < 0 {
+		end = len(doc)
+	} else {
+		end += start
+	}
+	if column == 0 || start+column-1 >= end {
+		return start, end
+	}
+	start += column - 1
+	if strings.IndexByte("[]()|", doc[start]) >= 0 {
+		return start, start + 1
+	}
+	if n := strings.IndexAny(doc[start:end], " \t[]()|"); n >= 0 {
+		end = start + n
+	}
+	return start, end
+}
+
+// hover describes the option at an offset of a Go source file.
+func hover(src string, offset int) (string, bool) {
+	for _, d := range findDocs(src) {
+		i, ok := d.offset(offset)
+		if !ok {
+			continue
+		}
+		name := wordAt(d.text, i)
+		if !strings.HasPrefix(name, "-") {
+			return "", false
+		}
+		data, err := (&docopt.Parser{}).Describe(d.text)
+		if err != nil {
+			return "", false
+		}
+		return describeOption(data, name)
+	}
+	return "", false
+}
+
+// wordAt returns the word of a usage pattern or option description at i.
+func wordAt(text string, i int) string {
+	isBreak := func(r byte) bool { return strings.IndexByte(" \t\n,=[]()|", r) >= 0 }
+	start, end := i, i
+	for start > 0 && !isBreak(text[start-1]) {
+		start--
+	}
+	for end < len(text) && !isBreak(text[end]) {
+		end++
+	}
+	return strings.TrimSuffix(text[start:end], "...")
+}
+
+// describeOption returns the hover text of an option.
+func describeOption(data *docopt.HelpData, name string) (string, bool) {
+	var option *docopt.HelpOption
+	for _, g := range data.Groups {
+		for i, o := range g.Options {
+			if o.Short == name || o.Long == name {
+				option = &g.Options[i]
+			}
+		}
+	}
+	lines := []string{}
+	shortcut := false
+	for _, line := range data.Usage {
+		for _, word := range strings.FieldsFunc(line, func(r rune) bool { return strings.ContainsRune(" []()|=", r) }) {
+			if word == name || option != nil && (word == option.Short || word == option.Long) {
+				lines = append(lines, line)
+				break
+			} else if word == "options" && option != nil && !shortcut {
+				lines = append(lines, line)
+				shortcut = true
+				break
+			}
+		}
+	}
+	if option == nil && len(lines) == 0 {
+		return "", false
+	}
+
+	var b strings.Builder
+	if option == nil {
+		b.WriteString("**" + name + "**\n\nNot described in an options section.\n")
+	} else {
+		names := strings.Trim(option.Short+", "+option.Long, ", ")
+		if option.Argument != "" {
+			names += " " + option.Argument
+		}
+		b.WriteString("**" + names + "**\n\n")
+		if option.Description != "" {
+			b.WriteString(option.Description + "\n\n")
+		}
+		if option.Argument == "" {
+			b.WriteString("Flag, takes no argument (argcount 0).\n")
+		} else {
+			b.WriteString("Takes an argument (argcount 1).\n")
+			if option.Default != "" {
+				b.WriteString("\nDefault: `" + option.Default + "`\n")
+			}
+		}
+	}
+	if len(lines) > 0 {
+		b.WriteString("\nUsed in:\n```\n" + strings.Join(lines, "\n") + "\n```\n")
+	}
+	return b.String(), true
+}
+
+// format aligns the options sections of the raw string docs of a Go source
+// file.
+func format(src string) []textEdit {
+	edits := []textEdit{}
+	for _, d := range findDocs(src) {
+		if !d.raw {
+			continue
+		}
+		if text := formatDoc(d.text); text != d.text {
+			start, end := d.fileOffset(0), d.fileOffset(len(d.text))
+			edits = append(edits, textEdit{span{pos(src, start), pos(src, end)}, text})
+		}
+	}
+	return edits
+}
+
+// formatDoc lines up the descriptions of the entries of the "options:"
+// sections of a doc, two spaces after the longest entry.
+func formatDoc(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		if !strings.Contains(strings.ToLower(lines[i]), "options:") {
+			continue
+		}
+		j := i + 1
+		for j < len(lines) && (strings.HasPrefix(lines[j], " ") || strings.HasPrefix(lines[j], "\t")) {
+			j++
+		}
+		formatOptions(lines[i+1 : j])
+		i = j - 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatOptions realigns the lines of an options section in place.
+func formatOptions(lines []string) {
+	type entry struct {
+		names, description string
+		continued          bool
+	}
+	entries := make([]entry, len(lines))
+	indent, width := "", 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "-") {
+			entries[i] = entry{description: trimmed, continued: true}
+			continue
+		}
+		names, description := trimmed, ""
+		if i := strings.Index(trimmed, "  "); i >= 0 {
+			names, description = trimmed[:i], trimmed[i+2:]
+		}
+		entries[i] = entry{names: names, description: strings.TrimSpace(description)}
+		if indent == "" {
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+		if n := docopt.DisplayWidth(names); n > width {
+			width = n
+		}
+	}
+	if width == 0 {
+		return
+	}
+	pad := strings.Repeat(" ", width+2)
+	for i, e := range entries {
+		switch {
+		case e.continued && e.description == "":
+			lines[i] = ""
+		case e.continued:
+			lines[i] = indent + pad + e.description
+		case e.description == "":
+			lines[i] = indent + e.names
+		default:
+			lines[i] = indent + e.names + pad[docopt.DisplayWidth(e.names):] + e.description
+		}
+	}
+}
+
+// pos returns the position of an offset of src.
+func pos(src string, offset int) position {
+	line := strings.Count(src[:offset], "\n")
+	start := strings.LastIndexByte(src[:offset], '\n') + 1
+	return position{line, len(utf16.Encode([]rune(src[start:offset])))}
+}
+
+// offset returns the offset of a position of src.
+func offset(src string, p position) int {
+	start := 0
+	for line := 0; line < p.Line; line++ {
+		i := strings.IndexByte(src[start:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		start += i + 1
+	}
+	units := 0
+	for i, r := range src[start:] {
+		if units >= p.Character || r == '\n' {
+			return start + i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(src)
+}
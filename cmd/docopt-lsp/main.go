@@ -0,0 +1,27 @@
+/*
+Docopt-lsp is a language server for docopt docs in Go source files.
+
+It speaks the Language Server Protocol over stdin and stdout. The docs are the
+string literals passed to docopt.Parse, Parser.ParseArgs, Parser.Check or
+Parser.Describe, directly or through a constant or variable of the same file.
+For these, it reports errors in the doc as diagnostics, shows the default,
+argument and usage lines of an option on hover, and formats the "options:"
+sections of raw string docs so their descriptions line up.
+
+Usage:
+
+	docopt-lsp
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if err := newServer(os.Stdin, os.Stdout).run(); err != nil {
+		fmt.Fprintln(os.Stderr, "docopt-lsp:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// request is a JSON-RPC request or notification; notifications have no ID.
+type request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type span struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text,omitempty"`
+}
+
+type diagnostic struct {
+	Range    span   `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type textEdit struct {
+	Range   span   `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// JSON-RPC error codes.
+const (
+	parseError     = -32700
+	methodNotFound = -32601
+	invalidParams  = -32602
+	internalError  = -32603
+)
+
+// rpcError is an error answered with its JSON-RPC code; other errors of
+// requests are internal errors.
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return e.message
+}
+
+// server is a language server reading requests from in and writing
+// responses and notifications to out.
+type server struct {
+	in    *textproto.Reader
+	out   io.Writer
+	files map[string]string // open documents by URI
+}
+
+func newServer(in io.Reader, out io.Writer) *server {
+	return &server{
+		in:    textproto.NewReader(bufio.NewReader(in)),
+		out:   out,
+		files: map[string]string{},
+	}
+}
+
+// run serves requests until the client sends `exit` or closes in.
+func (s *server) run() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			// the ID can not be read either, so the answer has none
+			if err := s.writeError(json.RawMessage("null"), &rpcError{parseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(req)
+		if req.ID == nil {
+			// the only errors of notifications are from sending
+			// diagnostics, and the client is gone then
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			err = s.writeError(req.ID, err)
+		} else {
+			err = s.write(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request, or acts on a notification.
+func (s *server) handle(req request) (interface{}, error) {
+	var params struct {
+		TextDocument   textDocument `json:"textDocument"`
+		Position       position     `json:"position"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			if req.ID == nil {
+				return nil, nil // a notification that can not be read is dropped
+			}
+			return nil, &rpcError{invalidParams, err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1, // full
+				"hoverProvider":              true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "docopt-lsp"},
+		}, nil
+	case "shutdown", "initialized", "$/cancelRequest":
+		return nil, nil
+	case "textDocument/didOpen":
+		s.files[uri] = params.TextDocument.Text
+		return nil, s.publish(uri)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.files[uri] = params.ContentChanges[n-1].Text
+		}
+		return nil, s.publish(uri)
+	case "textDocument/didClose":
+		delete(s.files, uri)
+		return nil, s.publish(uri)
+	case "textDocument/hover":
+		src := s.files[uri]
+		text, ok := hover(src, offset(src, params.Position))
+		if !ok {
+			return nil, nil
+		}
+		return map[string]interface{}{
+			"contents": map[string]string{"kind": "markdown", "value": text},
+		}, nil
+	case "textDocument/formatting":
+		return format(s.files[uri]), nil
+	}
+	if req.ID != nil {
+		return nil, &rpcError{methodNotFound, "method not found: " + req.Method}
+	}
+	return nil, nil
+}
+
+// publish sends the diagnostics of a document.
+func (s *server) publish(uri string) error {
+	return s.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/publishDiagnostics",
+		"params":  map[string]interface{}{"uri": uri, "diagnostics": diagnostics(s.files[uri])},
+	})
+}
+
+// read returns the body of the next message.
+func (s *server) read() ([]byte, error) {
+	header, err := s.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(s.in.R, body)
+	return body, err
+}
+
+// writeError answers the request id with err.
+func (s *server) writeError(id json.RawMessage, err error) error {
+	e, ok := err.(*rpcError)
+	if !ok {
+		e = &rpcError{internalError, err.Error()}
+	}
+	return s.write(map[string]interface{}{
+		"jsonrpc": "2.0", "id": id,
+		"error": map[string]interface{}{"code": e.code, "message": e.message},
+	})
+}
+
+// write sends a message.
+func (s *server) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const source = "package main\n\nimport \"github.com/docopt/docopt-go\"\n\n" +
+	"const usage = `Naval Fate.\n\n" +
+	"Usage:\n" +
+	"  naval_fate ship <name> move <x> <y> [--speed=<kn>]\n" +
+	"  naval_fate -h | --help\n\n" +
+	"Options:\n" +
+	"  -h --help  Show this screen.\n" +
+	"  --speed=<kn>    Speed in knots [default: 10].`\n\n" +
+	"func main() {\n" +
+	"\tdocopt.Parse(usage, nil, true, \"\", false)\n" +
+	"\t(&docopt.Parser{}).ParseArgs(`Usage: broken (<a>`, nil)\n" +
+	"}\n"
+
+// client drives a server over pipes.
+type client struct {
+	t    *testing.T
+	in   io.WriteCloser
+	out  *textproto.Reader
+	done chan error
+	id   int
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: textproto.NewReader(bufio.NewReader(outR)), done: make(chan error, 1)}
+	go func() {
+		c.done <- newServer(inR, outW).run()
+		outW.Close()
+	}()
+	return c
+}
+
+func (c *client) send(method string, params interface{}, request bool) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if request {
+		c.id++
+		msg["id"] = c.id
+	}
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// recv decodes the next message from the server into v.
+func (c *client) recv(v interface{}) {
+	header, err := c.out.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.out.R, body); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	doc := map[string]string{"uri": "file:///naval_fate.go"}
+
+	c.send("initialize", map[string]interface{}{}, true)
+	var init struct {
+		ID     int
+		Result struct {
+			Capabilities map[string]interface{}
+		}
+	}
+	c.recv(&init)
+	if init.ID != 1 || init.Result.Capabilities["hoverProvider"] != true {
+		t.Errorf("%+v", init)
+	}
+	c.send("initialized", map[string]interface{}{}, false)
+
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{"uri": doc["uri"], "languageId": "go", "text": source},
+	}, false)
+	var published struct {
+		Method string
+		Params struct {
+			URI         string
+			Diagnostics []diagnostic
+		}
+	}
+	c.recv(&published)
+	diags := published.Params.Diagnostics
+	if published.Method != "textDocument/publishDiagnostics" || len(diags) != 1 {
+		t.Fatalf("%+v", published)
+	}
+	// "(" of `Usage: broken (<a>` on line 16
+	if d := diags[0]; d.Range.Start != (position{16, 45}) || d.Range.End != (position{16, 46}) || !strings.Contains(d.Message, "(") {
+		t.Errorf("%+v", d)
+	}
+
+	// hover on --speed in the usage line
+	c.send("textDocument/hover", map[string]interface{}{
+		"textDocument": doc, "position": position{7, 43},
+	}, true)
+	var hover struct {
+		Result struct {
+			Contents struct{ Value string }
+		}
+	}
+	c.recv(&hover)
+	value := hover.Result.Contents.Value
+	for _, s := range []string{"**--speed <kn>**", "argcount 1", "Default: `10`", "naval_fate ship <name> move <x> <y> [--speed=<kn>]"} {
+		if !strings.Contains(value, s) {
+			t.Errorf("hover lacks %q: %q", s, value)
+		}
+	}
+
+	c.send("textDocument/formatting", map[string]interface{}{"textDocument": doc}, true)
+	var formatting struct {
+		Result []textEdit
+	}
+	c.recv(&formatting)
+	if len(formatting.Result) != 1 || !strings.Contains(formatting.Result[0].NewText,
+		"  -h --help     Show this screen.\n  --speed=<kn>  Speed in knots [default: 10].") {
+		t.Errorf("%+v", formatting)
+	}
+
+	c.send("shutdown", nil, true)
+	var shutdown map[string]interface{}
+	c.recv(&shutdown)
+	if _, ok := shutdown["result"]; !ok {
+		t.Error(shutdown)
+	}
+	c.send("exit", nil, false)
+	if err := <-c.done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	c := newClient(t)
+	fmt.Fprintf(c.in, "Content-Length: 9\r\n\r\n{garbage}")
+	var answer struct {
+		ID    *int
+		Error struct{ Code int }
+	}
+	c.recv(&answer)
+	if answer.ID != nil || answer.Error.Code != -32700 {
+		t.Errorf("%+v", answer)
+	}
+
+	// the server still answers
+	c.send("initialize", map[string]interface{}{}, true)
+	var init struct {
+		ID     int
+		Result map[string]interface{}
+	}
+	c.recv(&init)
+	if init.ID != 1 || init.Result["capabilities"] == nil {
+		t.Errorf("%+v", init)
+	}
+
+	c.send("textDocument/hover", map[string]interface{}{"position": "top"}, true)
+	answer.Error.Code = 0
+	c.recv(&answer)
+	if answer.ID == nil || *answer.ID != 2 || answer.Error.Code != -32602 {
+		t.Errorf("%+v", answer)
+	}
+	c.send("textDocument/rename", map[string]interface{}{}, true)
+	c.recv(&answer)
+	if *answer.ID != 3 || answer.Error.Code != -32601 {
+		t.Errorf("%+v", answer)
+	}
+
+	c.send("exit", nil, false)
+	if err := <-c.done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	var out strings.Builder
+	newServer(strings.NewReader(""), &out).writeError(json.RawMessage("7"), io.ErrUnexpectedEOF)
+	if !strings.HasSuffix(out.String(), `{"error":{"code":-32603,"message":"unexpected EOF"},"id":7,"jsonrpc":"2.0"}`) {
+		t.Error(out.String())
+	}
+}
+
+type brokenPipe struct{}
+
+func (brokenPipe) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestNotificationWriteError(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen",
+		"params": map[string]interface{}{"textDocument": map[string]string{"uri": "file:///a.go", "text": source}}})
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body))
+	if err := newServer(in, brokenPipe{}).run(); err != io.ErrClosedPipe {
+		t.Error(err)
+	}
+}
+
+func TestFormatDoc(t *testing.T) {
+	doc := `Usage: prog [options]
+
+Options:
+  -v, --verbose  Talk more.
+  --output=<file>      Write to <file>,
+                       or stdout.
+  -q  Talk less.
+
+Other options:
+    --color`
+	expect := `Usage: prog [options]
+
+Options:
+  -v, --verbose    Talk more.
+  --output=<file>  Write to <file>,
+                   or stdout.
+  -q               Talk less.
+
+Other options:
+    --color`
+	if s := formatDoc(doc); s != expect {
+		t.Errorf("%s", s)
+	}
+}
+
+func TestFormatDocWideText(t *testing.T) {
+	doc := `Usage: prog [options]
+
+Options:
+  -n, --name=<名前>  名前を設定する。
+  --lang=<言語>       使用する言語。
+  -v  詳細を表示する。`
+	expect := `Usage: prog [options]
+
+Options:
+  -n, --name=<名前>  名前を設定する。
+  --lang=<言語>      使用する言語。
+  -v                 詳細を表示する。`
+	if s := formatDoc(doc); s != expect {
+		t.Errorf("%s", s)
+	}
+}
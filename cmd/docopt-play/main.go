@@ -0,0 +1,26 @@
+/*
+Docopt-play is a local playground for docopt docs.
+
+It serves a single page on which you edit a doc and an argv, and see the
+parsed arguments, why parsing failed, the pattern argv is matched against and
+the help the doc prints.
+
+Usage:
+
+	docopt-play [-addr=<host:port>]
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	flag.Parse()
+	fmt.Printf("docopt-play on http://%s/\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newHandler()))
+}
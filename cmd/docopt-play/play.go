@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+)
+
+//go:embed static
+var static embed.FS
+
+// request is what the page posts to /parse.
+type request struct {
+	Doc          string `json:"doc"`
+	Argv         string `json:"argv"`
+	Help         bool   `json:"help"`
+	Version      string `json:"version"`
+	OptionsFirst bool   `json:"optionsFirst"`
+}
+
+// response is what /parse answers.
+type response struct {
+	Args        docopt.Opts `json:"args"`
+	Error       string      `json:"error,omitempty"`
+	Kind        string      `json:"kind,omitempty"` // "user", "language" or "limit"
+	Explanation string      `json:"explanation,omitempty"`
+	Output      string      `json:"output,omitempty"` // what the program would print
+	Tree        string      `json:"tree,omitempty"`
+	Help        string      `json:"help,omitempty"`
+}
+
+// newHandler serves the page and its /parse endpoint.
+func newHandler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.HandleFunc("/parse", handleParse)
+	return mux
+}
+
+func handleParse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	argv, err := splitArgv(req.Argv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(parse(req, argv))
+}
+
+// parse runs the parser of a request on argv.
+func parse(req request, argv []string) response {
+	var stdout, stderr bytes.Buffer
+	p := &docopt.Parser{
+		Help:         req.Help,
+		Version:      req.Version,
+		OptionsFirst: req.OptionsFirst,
+		FS:           noFiles{},
+		Stdin:        strings.NewReader(""),
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+		NoPager:      true,
+	}
+	var res response
+	var err error
+	res.Args, err = p.ParseArgs(req.Doc, argv)
+	res.Output = strings.TrimSuffix(stdout.String()+stderr.String(), "\n")
+	if err != nil {
+		res.Error = err.Error()
+		res.Kind, res.Explanation = explain(err)
+	}
+	if tree, err := p.Tree(req.Doc); err == nil {
+		res.Tree = tree
+	}
+
+	stdout.Reset()
+	help := &docopt.Parser{Help: true, Stdout: &stdout, Stderr: io.Discard, NoPager: true}
+	if _, err := help.ParseArgs(req.Doc, []string{"--help"}); err == nil {
+		res.Help = strings.TrimSuffix(stdout.String(), "\n")
+	}
+	return res
+}
+
+// explain says what kind of error err is, and what to do about it.
+func explain(err error) (string, string) {
+	switch e := err.(type) {
+	case *docopt.UserError:
+		if e.Error() == "" {
+			return "user", "The doc is fine, but argv matches none of its usage patterns."
+		}
+		return "user", "The doc is fine, but argv does not fit it: " + e.Error() + "."
+	case *docopt.LanguageError:
+		return "language", "The doc itself is invalid, so no argv can be parsed with it: " + e.Error()
+	case *docopt.LimitError:
+		return "limit", "The doc or argv is larger than Limits." + e.Limit + " allows: " + e.Error()
+	}
+	return "", err.Error()
+}
+
+// noFiles refuses to open the files of [type: infile] and [type: outfile],
+// but lets every name pass when arguments are parsed, so that results are
+// still shown.
+type noFiles struct{}
+
+func (noFiles) Access(name string, write bool) error {
+	return nil
+}
+
+func (noFiles) Open(name string) (io.ReadCloser, error) {
+	return nil, os.ErrPermission
+}
+
+func (noFiles) Create(name string) (io.WriteCloser, error) {
+	return nil, os.ErrPermission
+}
+
+// splitArgv splits a command line into words like a POSIX shell, with single
+// and double quotes and backslash escapes.
+func splitArgv(s string) ([]string, error) {
+	argv := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				argv = append(argv, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape in argv")
+	}
+	if inWord {
+		argv = append(argv, word.String())
+	}
+	return argv, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const naval = `Naval Fate.
+
+Usage:
+  naval_fate ship <name> move <x> <y> [--speed=<kn>]
+  naval_fate -h | --help
+
+Options:
+  -h --help     Show this screen.
+  --speed=<kn>  Speed in knots [default: 10].`
+
+func post(t *testing.T, srv *httptest.Server, req request) response {
+	body, _ := json.Marshal(req)
+	resp, err := http.Post(srv.URL+"/parse", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestPage(t *testing.T) {
+	srv := httptest.NewServer(newHandler())
+	defer srv.Close()
+	for path, want := range map[string]string{"/": "<textarea", "/play.js": "fetch(", "/play.css": "pre"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("%s: %s %q", path, resp.Status, body)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	srv := httptest.NewServer(newHandler())
+	defer srv.Close()
+
+	res := post(t, srv, request{Doc: naval, Argv: `ship "Black Pearl" move 1 2`, Help: true})
+	expect := map[string]interface{}{
+		"ship": true, "move": true, "<name>": "Black Pearl", "<x>": "1", "<y>": "2",
+		"--speed": "10", "--help": false,
+	}
+	if res.Error != "" || !reflect.DeepEqual(map[string]interface{}(res.Args), expect) {
+		t.Errorf("%+v", res)
+	}
+	if !strings.HasPrefix(res.Tree, "required\n") || res.Help != naval {
+		t.Errorf("%q %q", res.Tree, res.Help)
+	}
+
+	res = post(t, srv, request{Doc: naval, Argv: "ship Guardian move 1 2 --sped=3", Help: true})
+	if res.Args != nil || res.Kind != "user" || !strings.Contains(res.Explanation, "unknown option --sped") ||
+		!strings.HasPrefix(res.Output, "naval_fate: error: unknown option --sped\nUsage:") {
+		t.Errorf("%+v", res)
+	}
+
+	res = post(t, srv, request{Doc: naval, Argv: "--help", Help: true})
+	if res.Error != "" || res.Output != naval {
+		t.Errorf("%+v", res)
+	}
+
+	res = post(t, srv, request{Doc: "Usage: prog (<a>", Argv: "x"})
+	if res.Kind != "language" || res.Tree != "" || res.Help != "" {
+		t.Errorf("%+v", res)
+	}
+}
+
+func TestParseBadRequests(t *testing.T) {
+	srv := httptest.NewServer(newHandler())
+	defer srv.Close()
+	resp, _ := http.Get(srv.URL + "/parse")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Error(resp.Status)
+	}
+	for _, body := range []string{"{", `{"doc": "Usage: prog <a>", "argv": "'unterminated"}`} {
+		resp, _ = http.Post(srv.URL+"/parse", "application/json", strings.NewReader(body))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Error(body, resp.Status)
+		}
+	}
+}
+
+func TestSplitArgv(t *testing.T) {
+	argv, err := splitArgv(`ship  "Black Pearl" 'it''s' a\ b "say \"hi\"" ''`)
+	expect := []string{"ship", "Black Pearl", "its", "a b", `say "hi"`, ""}
+	if err != nil || !reflect.DeepEqual(argv, expect) {
+		t.Errorf("%q %v", argv, err)
+	}
+}
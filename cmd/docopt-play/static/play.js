@@ -0,0 +1,42 @@
+"use strict";
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+async function parse(event) {
+  if (event) {
+    event.preventDefault();
+  }
+  const response = await fetch("parse", {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify({
+      doc: $("doc").value,
+      argv: $("argv").value,
+      help: $("help").checked,
+      optionsFirst: $("optionsFirst").checked,
+      version: $("version").value,
+    }),
+  });
+  if (!response.ok) {
+    $("explanation").textContent = await response.text();
+    return;
+  }
+  const result = await response.json();
+  $("explanation").textContent = result.explanation || (result.args ? "argv matches the doc." : "");
+  $("explanation").className = result.kind || "";
+  $("args").textContent = result.args ? formatArgs(result.args) : "";
+  $("output").textContent = result.output || "";
+  $("tree").textContent = result.tree || "";
+  $("helptext").textContent = result.help || "(the doc prints no help without -h or --help)";
+}
+
+function formatArgs(args) {
+  const keys = Object.keys(args).sort();
+  const width = Math.max(...keys.map((k) => k.length));
+  return keys.map((k) => k.padEnd(width) + "  " + JSON.stringify(args[k])).join("\n");
+}
+
+$("play").addEventListener("submit", parse);
+parse();
@@ -0,0 +1,159 @@
+package docopt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// compiled is a doc made ready to match argv against, for parse, Describe
+// and Tree.
+type compiled struct {
+	// parser has the modes of the directives of the doc set.
+	parser *Parser
+	// doc has its includes expanded and its comments and directives left
+	// out; origins are where each of its lines comes from.
+	doc     string
+	origins []origin
+	syntax  OptionSyntax
+	usage   string
+	// options are those of the "options:" sections, and those the usage
+	// adds.
+	options patternList
+	// pat is the usage, with the options of `[options]` filled in.
+	pat *pattern
+}
+
+// compile expands the includes of doc, applies its directives and parses
+// its usage into a pattern.
+func (p *Parser) compile(doc string, limits Limits) (_ *compiled, err error) {
+	if limits.exceeded(limits.DocSize, len(doc)) {
+		return nil, newLimitError("DocSize", "doc is longer than %d bytes", limits.DocSize)
+	}
+	c := &compiled{}
+	doc, origins, err := p.include(doc, limits)
+	if err != nil {
+		return nil, err
+	}
+	c.doc, c.origins, c.parser, err = p.directives(doc, origins)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = c.locate(err) }()
+
+	usageSections, at := sectionsAt("usage:", c.doc)
+	if len(usageSections) == 0 {
+		return nil, newLanguageError("\"usage:\" (case-insensitive) not found.")
+	}
+	if len(usageSections) > 1 {
+		return nil, errorAt(newLanguageError("More than one \"usage:\" (case-insensitive)."), at[1])
+	}
+	c.usage = usageSections[0]
+
+	c.syntax = c.parser.Syntax.withDefaults()
+	c.options = c.syntax.parseDefaults(c.doc)
+	tokens, err := usageTokens(c.usage, at[0])
+	if err != nil {
+		return nil, err
+	}
+	tokens.limits = limits
+	tokens.syntax = c.syntax
+	c.pat, err = parsePatternTokens(tokens, &c.options)
+	if err != nil {
+		return nil, err
+	}
+
+	patternOptions, err := c.pat.flat(patternOption)
+	if err != nil {
+		return nil, err
+	}
+	negatable := negatableNames(c.options)
+	markNegatable(patternOptions, negatable)
+	shortcuts, err := c.pat.flat(patternOptionSSHORTCUT)
+	if err != nil {
+		return nil, err
+	}
+	if len(shortcuts) > 0 {
+		docOptions := c.syntax.parseDefaults(c.doc).unique()
+		markNegatable(docOptions, negatable)
+		for _, shortcut := range shortcuts {
+			shortcut.children = docOptions.diff(patternOptions.unique())
+		}
+	}
+	if err := c.pat.fix(); err != nil {
+		return nil, err
+	}
+	c.pat = c.pat.simplified()
+	return c, nil
+}
+
+// locate sets the file, line and column of a LanguageError from its offset
+// in the doc.
+func (c *compiled) locate(err error) error {
+	e, ok := err.(*LanguageError)
+	if !ok || e.at == 0 || e.Line != 0 {
+		return err
+	}
+	before := c.doc[:e.at-1]
+	e.Column = len(before) - strings.LastIndexByte(before, '\n')
+	return c.origins[strings.Count(before, "\n")].locate(err)
+}
+
+// usageTokens returns the tokens of the usage section, as tokenListFromPattern
+// returns them for its formalUsage, with their offsets in the doc, where the
+// section is at offset. Errors in them are at the token moved past last.
+func usageTokens(usage string, offset int) (*tokenList, error) {
+	_, _, section := stringPartition(usage, ":") // drop "usage:"
+	base := offset + len(usage) - len(section)
+	fields := regexp.MustCompile(`\S+`).FindAllStringIndex(section, -1)
+	if len(fields) == 0 {
+		return nil, errorAt(newLanguageError("no fields found in usage (perhaps a spacing error)."), offset)
+	}
+
+	// formalUsage, keeping where each field starts in it and in the doc;
+	// the parentheses it adds are at the program name
+	prog := section[fields[0][0]:fields[0][1]]
+	var formal strings.Builder
+	formal.WriteString("(")
+	starts, ends, offsets := []int{0}, []int{1}, []int{base + fields[0][0]}
+	for _, f := range fields[1:] {
+		word := section[f[0]:f[1]]
+		if word == prog {
+			word = ") | ("
+		}
+		formal.WriteString(" ")
+		starts, offsets = append(starts, formal.Len()), append(offsets, base+f[0])
+		if word == ") | (" {
+			ends = append(ends, formal.Len()) // all at the program name
+		} else {
+			ends = append(ends, formal.Len()+len(word))
+		}
+		formal.WriteString(word)
+	}
+	formal.WriteString(" )")
+	starts, ends, offsets = append(starts, formal.Len()-1), append(ends, formal.Len()-1), append(offsets, base+fields[len(fields)-1][1])
+
+	tokens := tokenListFromPattern(formal.String())
+	tokens.inserted = map[int]bool{}
+	source, cursor, k := formal.String(), 0, 0
+	for _, tok := range tokens.tokens {
+		at := cursor
+		if i := strings.Index(source[cursor:], tok); i >= 0 {
+			at, cursor = cursor+i, cursor+i+len(tok)
+		}
+		for k+1 < len(starts) && starts[k+1] <= at {
+			k++
+		}
+		within := at - starts[k]
+		if within > ends[k]-starts[k] {
+			within = ends[k] - starts[k]
+		}
+		tokens.offsets = append(tokens.offsets, offsets[k]+within)
+		if k == 0 || k == len(starts)-1 || ends[k] == starts[k] {
+			tokens.inserted[offsets[k]] = true
+		}
+	}
+	tokens.errorFunc = func(msg string, f ...interface{}) error {
+		return errorAt(newLanguageError(msg, f...), tokens.moved)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,178 @@
+package docopt
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// reCounter matches a `[counter: ...]` annotation in a description, which
+// links options to a shared counter:
+//
+//	-v, --verbose    Louder. [counter: verbosity +1 base=1 min=0 max=3]
+//	-q, --quiet      Quieter. [counter: verbosity -1]
+//	--verbosity=<n>  Set the level. [counter: verbosity]
+//
+// Flags step the counter, by +1 unless given; options with an argument set
+// it. The settings of the counter may be spread over its options: base is
+// its value when none of them are given, min and max clamp it, and levels,
+// a comma-separated list, names its values from min (or 0) up. The result
+// has the counter under its name instead of the linked options.
+var reCounter = regexp.MustCompile(`(?i)\[counter: *([^\]]*)\]`)
+
+type counter struct {
+	name           string
+	base, min, max int
+	hasMin, hasMax bool
+	levels         []string
+	steps          map[string]int // by option name, 0 for options that set it
+}
+
+// parseCounters returns the counters of the options of doc, in the order of
+// the doc.
+func parseCounters(doc string, syntax OptionSyntax) ([]*counter, error) {
+	counters := []*counter{}
+	byName := map[string]*counter{}
+	descriptions, at := syntax.optionDescriptionsAt(doc)
+	for i, description := range descriptions {
+		_, _, text := stringPartition(description, "  ")
+		matched := reCounter.FindStringSubmatchIndex(text)
+		if matched == nil {
+			continue
+		}
+		// errors are at the annotation
+		offset := at[i] + len(description) - len(text) + matched[0]
+		annotation := text[matched[0]:matched[1]]
+		fields := strings.Fields(text[matched[2]:matched[3]])
+		if len(fields) == 0 {
+			return nil, errorAt(newLanguageError("counter without a name: %s", annotation), offset)
+		}
+		c, ok := byName[fields[0]]
+		if !ok {
+			c = &counter{name: fields[0], steps: map[string]int{}}
+			byName[c.name] = c
+			counters = append(counters, c)
+		}
+		option := syntax.parseOption(description)
+		step := 1
+		if option.argcount > 0 {
+			step = 0
+		}
+		for _, field := range fields[1:] {
+			key, eq, value := stringPartition(field, "=")
+			if eq == "" {
+				n, err := strconv.Atoi(key)
+				if err != nil || !strings.ContainsAny(key[:1], "+-") || n == 0 || option.argcount > 0 {
+					return nil, errorAt(newLanguageError("%s: invalid step %s for counter %s", option.name, key, c.name), offset)
+				}
+				step = n
+				continue
+			}
+			if key == "levels" {
+				c.levels = strings.Split(value, ",")
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errorAt(newLanguageError("%s: %s of counter %s must be an integer", option.name, key, c.name), offset)
+			}
+			switch key {
+			case "base":
+				c.base = n
+			case "min":
+				c.min, c.hasMin = n, true
+			case "max":
+				c.max, c.hasMax = n, true
+			default:
+				return nil, errorAt(newLanguageError("%s: unknown setting %s of counter %s", option.name, key, c.name), offset)
+			}
+		}
+		c.steps[option.name] = step
+	}
+	return counters, nil
+}
+
+// repeatCounted lets the flags that step a counter be repeated anywhere in
+// the pattern, like `-v...`.
+func repeatCounted(p *pattern, counters []*counter) {
+	for i, child := range p.children {
+		if child.t&patternBranch != 0 {
+			repeatCounted(child, counters)
+			continue
+		}
+		if child.t&patternOption == 0 || p.t&patternOneOrMore != 0 {
+			continue
+		}
+		for _, c := range counters {
+			if step, ok := c.steps[child.name]; ok && step != 0 {
+				child.value = 0
+				p.children[i] = newOneOrMore(child)
+				break
+			}
+		}
+	}
+}
+
+// applyCounters replaces the linked options in args by their counters,
+// following the options of argv in order.
+func applyCounters(args map[string]interface{}, argv patternList, counters []*counter) error {
+	for _, c := range counters {
+		value := c.clamp(c.base)
+		for _, o := range argv {
+			step, ok := c.steps[o.name]
+			if !ok || o.t&patternOption == 0 || o.value == false {
+				continue
+			}
+			if step != 0 {
+				value = c.clamp(value + step)
+				continue
+			}
+			n, err := c.parse(o.value)
+			if err != nil {
+				return err
+			}
+			value = c.clamp(n)
+		}
+		for name := range c.steps {
+			delete(args, name)
+		}
+		args[c.name] = value
+		if c.levels != nil {
+			args[c.name] = c.levels[value-c.min]
+		}
+	}
+	return nil
+}
+
+// parse reads the value of an option that sets the counter: an integer, or
+// the name of a level.
+func (c *counter) parse(value interface{}) (int, error) {
+	s, _ := value.(string)
+	for i, level := range c.levels {
+		if s == level {
+			return c.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		if c.levels != nil {
+			return 0, newUserError("%s must be an integer or one of %s", c.name, strings.Join(c.levels, ", "))
+		}
+		return 0, newUserError("%s must be an integer", c.name)
+	}
+	return n, nil
+}
+
+func (c *counter) clamp(n int) int {
+	max, hasMax := c.max, c.hasMax
+	if c.levels != nil && (!hasMax || max > c.min+len(c.levels)-1) {
+		max, hasMax = c.min+len(c.levels)-1, true
+	}
+	if hasMax && n > max {
+		n = max
+	}
+	if (c.hasMin || c.levels != nil) && n < c.min {
+		n = c.min
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+const countersDoc = `Usage: prog [options] <file>
+
+Options:
+  -v, --verbose    Louder. [counter: verbosity +1 base=1 min=0 max=3]
+  -q, --quiet      Quieter. [counter: verbosity -1]
+  --verbosity=<n>  Set the level [default: 1]. [counter: verbosity]
+  -f, --force      Overwrite.`
+
+func TestCounters(t *testing.T) {
+	for _, tc := range []struct {
+		argv      []string
+		verbosity int
+	}{
+		{[]string{"f"}, 1},
+		{[]string{"-v", "f"}, 2},
+		{[]string{"-vvvvv", "f"}, 3},
+		{[]string{"-q", "-q", "-q", "f"}, 0},
+		{[]string{"-qqq", "-v", "f"}, 1},
+		{[]string{"--verbosity=2", "-q", "f"}, 1},
+		{[]string{"-vv", "--verbosity=0", "f"}, 0},
+		{[]string{"--verbosity=9", "f"}, 3},
+	} {
+		v, err := (&Parser{}).ParseArgs(countersDoc, tc.argv)
+		expect := map[string]interface{}{"verbosity": tc.verbosity, "--force": false, "<file>": "f"}
+		if err != nil || !reflect.DeepEqual(v, expect) {
+			t.Errorf("%v: %v %v", tc.argv, v, err)
+		}
+	}
+
+	_, _, err := (&Parser{}).parse(countersDoc, []string{"--verbosity=loud", "f"})
+	if _, ok := err.(*UserError); !ok || err.Error() != "verbosity must be an integer" {
+		t.Error(err)
+	}
+}
+
+func TestCounterLevels(t *testing.T) {
+	doc := `Usage: prog [-v...] [-q...] [--level=<l>]
+
+Options:
+  -v  Louder. [counter: level base=1 levels=quiet,normal,verbose,debug]
+  -q  Quieter. [counter: level -1]
+  --level=<l>  Set the level. [counter: level]`
+	for _, tc := range []struct {
+		argv  []string
+		level string
+	}{
+		{[]string{}, "normal"},
+		{[]string{"-vvvvv"}, "debug"},
+		{[]string{"-qq"}, "quiet"},
+		{[]string{"--level=verbose", "-v"}, "debug"},
+		{[]string{"--level=0"}, "quiet"},
+	} {
+		v, err := (&Parser{}).ParseArgs(doc, tc.argv)
+		if err != nil || !reflect.DeepEqual(v, map[string]interface{}{"level": tc.level}) {
+			t.Errorf("%v: %v %v", tc.argv, v, err)
+		}
+	}
+	_, _, err := (&Parser{}).parse(doc, []string{"--level=loud"})
+	if err == nil || err.Error() != "level must be an integer or one of quiet, normal, verbose, debug" {
+		t.Error(err)
+	}
+}
+
+func TestCounterLanguageErrors(t *testing.T) {
+	for _, doc := range []string{
+		"Usage: prog [-v]\n\nOptions:\n  -v  Louder. [counter: ]",
+		"Usage: prog [-v]\n\nOptions:\n  -v  Louder. [counter: n 2]",
+		"Usage: prog [-v]\n\nOptions:\n  -v  Louder. [counter: n max=high]",
+		"Usage: prog [-v]\n\nOptions:\n  -v  Louder. [counter: n step=1]",
+		"Usage: prog [--n=<n>]\n\nOptions:\n  --n=<n>  Set. [counter: n +1]",
+	} {
+		if _, _, err := (&Parser{}).parse(doc, []string{}); err == nil {
+			t.Errorf("no error for %q", doc)
+		} else if _, ok := err.(*LanguageError); !ok {
+			t.Errorf("%q: %v", doc, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package docopt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// reDefaultMark marks the default command in a "commands:" section:
+//
+//	Commands:
+//	  run   Run a file [default]
+//	  lint  Check a file
+var reDefaultMark = regexp.MustCompile(`(?i)\s*\[default\]`)
+
+// defaultCommand returns the command inserted into argv that names none:
+// Parser.DefaultCommand, or else the one marked `[default]` in a
+// "commands:" section of the doc. It must be a single command of pat.
+func (p *Parser) defaultCommand(doc string, pat *pattern) (string, error) {
+	name, at := p.DefaultCommand, -1
+	if name == "" {
+		name, at = markedDefault(doc)
+	}
+	if name == "" {
+		return "", nil
+	}
+	if len(strings.Fields(name)) > 1 {
+		return "", errorAt(newLanguageError("default command %q is more than one word", name), at)
+	}
+	commands, _ := pat.flat(patternCommand)
+	for _, c := range commands {
+		if c.name == name {
+			return name, nil
+		}
+	}
+	return "", errorAt(newLanguageError("default command %s is not in the usage", name), at)
+}
+
+// markedDefault returns the command marked `[default]` in the "commands:"
+// sections of doc, if any, and the offset of its line in doc. Like in help,
+// the command is what comes before two spaces on its line.
+func markedDefault(doc string) (string, int) {
+	sections, at := sectionsAt("commands:", doc)
+	for i, section := range sections {
+		title, _, section := stringPartition(section, ":")
+		offset := at[i] + len(title) + 1
+		for _, line := range strings.Split(section, "\n") {
+			if reDefaultMark.MatchString(line) {
+				name, _, _ := stringPartition(strings.TrimSpace(reDefaultMark.ReplaceAllString(line, "")), "  ")
+				return name, offset + len(line) - len(strings.TrimLeft(line, " \t"))
+			}
+			offset += len(line) + 1
+		}
+	}
+	return "", -1
+}
+
+// withDefault returns argv with the default command inserted before the
+// first argument, unless one of its arguments is already a command of pat.
+// The values of options in argv are parsed with them, not as arguments.
+func withDefault(argv patternList, pat *pattern, name string, fold func(string) string) (patternList, bool) {
+	commands, _ := pat.flat(patternCommand)
+	same := func(a, b string) bool {
+		return a == b || fold != nil && fold(a) == fold(b)
+	}
+	at := len(argv)
+	for i, a := range argv {
+		if a.t&patternArgument == 0 {
+			continue
+		}
+		if i < at {
+			at = i
+		}
+		for _, c := range commands {
+			if value, ok := a.value.(string); ok && same(value, c.name) {
+				return nil, false
+			}
+		}
+	}
+	retried := append(append(append(patternList{}, argv[:at]...), newArgument("", name)), argv[at:]...)
+	return retried, true
+}
+
+// markDefault marks the default command set from Go in the "commands:"
+// sections of doc, for help.
+func (p *Parser) markDefault(doc string) string {
+	if marked, _ := markedDefault(doc); p.DefaultCommand == "" || marked != "" {
+		return doc
+	}
+	for _, section := range parseSection("commands:", doc) {
+		lines := strings.Split(section, "\n")
+		for i, line := range lines[1:] {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == p.DefaultCommand {
+				lines[i+1] = strings.TrimRight(line, " ") + " [default]"
+				return strings.Replace(doc, section, strings.Join(lines, "\n"), 1)
+			}
+		}
+	}
+	return doc
+}
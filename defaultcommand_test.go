@@ -0,0 +1,93 @@
+package docopt
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+const runnerDoc = `Usage:
+  runner run [--watch] <file>
+  runner lint <file>...
+
+Commands:
+  run   Run a file [default]
+  lint  Check files
+`
+
+func TestDefaultCommand(t *testing.T) {
+	for _, tc := range []struct {
+		argv      []string
+		expect    map[string]interface{}
+		defaulted string
+	}{
+		{[]string{"main.go"}, map[string]interface{}{"run": true, "lint": false, "--watch": false, "<file>": []string{"main.go"}}, "run"},
+		{[]string{"--watch", "main.go"}, map[string]interface{}{"run": true, "lint": false, "--watch": true, "<file>": []string{"main.go"}}, "run"},
+		{[]string{"lint", "a.go", "b.go"}, map[string]interface{}{"run": false, "lint": true, "--watch": false, "<file>": []string{"a.go", "b.go"}}, ""},
+	} {
+		defaulted := ""
+		v, err := (&Parser{Defaulted: func(command string) { defaulted = command }}).ParseArgs(runnerDoc, tc.argv)
+		if err != nil || !reflect.DeepEqual(v, tc.expect) || defaulted != tc.defaulted {
+			t.Errorf("%v: %v %v %q", tc.argv, v, err, defaulted)
+		}
+	}
+	// a known command is not defaulted
+	if _, _, err := (&Parser{}).parse(runnerDoc, []string{"lint"}); err == nil {
+		t.Error("lint without files matched")
+	}
+
+	doc := strings.Replace(runnerDoc, " [default]", "", 1)
+	defaulted := ""
+	p := &Parser{DefaultCommand: "lint", Defaulted: func(command string) { defaulted = command }}
+	if v, err := p.ParseArgs(doc, []string{"a.go", "b.go"}); err != nil || defaulted != "lint" {
+		t.Error(v, err, defaulted)
+	}
+	if _, err := (&Parser{DefaultCommand: "build"}).ParseArgs(doc, []string{"a.go"}); err == nil {
+		t.Error("default command not in usage")
+	} else if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+
+	// a default is a single command
+	multi := strings.Replace(runnerDoc, "  run   Run a file [default]", "  run fast  Run a file [default]", 1)
+	if _, err := (&Parser{}).ParseArgs(multi, []string{"a.go"}); err == nil {
+		t.Error("multi-word default command accepted")
+	} else if e, ok := err.(*LanguageError); !ok || e.Line != 6 {
+		t.Error(err)
+	}
+	if _, err := (&Parser{DefaultCommand: "run fast"}).ParseArgs(doc, []string{"a.go"}); err == nil {
+		t.Error("multi-word default command accepted")
+	}
+}
+
+func TestDefaultCommandAfterOptionValues(t *testing.T) {
+	doc := strings.Replace(runnerDoc, "runner run [--watch] <file>", "runner run [--watch] [--env=<name>] <file>", 1) +
+		"\nOptions:\n  --watch       Rerun on changes.\n  --env=<name>  Environment.\n"
+	// the value of --env is not taken for the first argument
+	for _, argv := range [][]string{{"--env", "prod", "main.go"}, {"--en", "prod", "main.go"}, {"--env=prod", "--watch", "main.go"}} {
+		defaulted := ""
+		v, err := (&Parser{Defaulted: func(command string) { defaulted = command }}).ParseArgs(doc, argv)
+		if err != nil || v["--env"] != "prod" || !reflect.DeepEqual(v["<file>"], []string{"main.go"}) || defaulted != "run" {
+			t.Errorf("%v: %v %v %q", argv, v, err, defaulted)
+		}
+	}
+}
+
+func TestDefaultCommandInHelp(t *testing.T) {
+	var out bytes.Buffer
+	p := &Parser{Help: true, Stdout: &out, NoPager: true, DefaultCommand: "run"}
+	p.ParseArgs(strings.Replace(runnerDoc, " [default]", "", 1), []string{"--help"})
+	if !strings.Contains(out.String(), "  run   Run a file [default]\n") {
+		t.Error(out.String())
+	}
+
+	out.Reset()
+	p = &Parser{Help: true, Stdout: &out, NoPager: true, HelpTemplate: template.Must(template.New("").Parse(
+		`{{range .Commands}}{{.Name}}: {{.Description}}{{if .Default}} (default){{end}}{{"\n"}}{{end}}`))}
+	p.ParseArgs(runnerDoc, []string{"--help"})
+	if out.String() != "run: Run a file (default)\nlint: Check files\n" {
+		t.Errorf("%q", out.String())
+	}
+}
@@ -0,0 +1,77 @@
+package docopt
+
+import "strings"
+
+// directivePrefix starts a line of the doc that sets parser modes, such as
+//
+//	#!docopt options-first strict-long no-abbrev
+//
+// Each word turns a mode on, or off with a "no-" prefix:
+//
+//	options-first     Parser.OptionsFirst
+//	strict-long       Parser.StrictLong
+//	abbrev            Parser.AbbreviateCommands
+//	case-insensitive  Parser.CaseInsensitive
+//	flag-values       Parser.FlagValues
+//	comments          Parser.Comments
+//
+// Parser.Directives overrides them from Go.
+const directivePrefix = "#!docopt"
+
+// directives are the modes directive lines can set.
+var directives = map[string]func(p *Parser, on bool){
+	"options-first":    func(p *Parser, on bool) { p.OptionsFirst = on },
+	"strict-long":      func(p *Parser, on bool) { p.StrictLong = on },
+	"abbrev":           func(p *Parser, on bool) { p.AbbreviateCommands = on },
+	"case-insensitive": func(p *Parser, on bool) { p.CaseInsensitive = on },
+	"flag-values":      func(p *Parser, on bool) { p.FlagValues = on },
+	"comments":         func(p *Parser, on bool) { p.Comments = on },
+}
+
+// isComment reports whether a line of the doc is a comment: `#` alone or
+// followed by a space, after any indentation.
+func isComment(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	return line == "#" || strings.HasPrefix(line, "# ") || strings.HasPrefix(line, "#\t")
+}
+
+// directives returns doc without its directive lines, and without its
+// comment lines if the comments mode is on, with the origins of the lines
+// left, and a copy of the parser with the modes of the directives set,
+// unless overridden by Directives.
+func (p *Parser) directives(doc string, origins []origin) (string, []origin, *Parser, error) {
+	q := *p
+	source := strings.Split(doc, "\n")
+	isDirective := make([]bool, len(source))
+	for i, line := range source {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, directivePrefix) {
+			continue
+		}
+		isDirective[i] = true
+		for _, word := range strings.Fields(strings.TrimPrefix(trimmed, directivePrefix)) {
+			name, on := strings.TrimPrefix(word, "no-"), !strings.HasPrefix(word, "no-")
+			set, ok := directives[name]
+			if !ok {
+				return "", nil, nil, origins[i].locate(newLanguageError("unknown directive %s in %q", word, trimmed))
+			}
+			set(&q, on)
+		}
+	}
+	for name, on := range p.Directives {
+		set, ok := directives[name]
+		if !ok {
+			return "", nil, nil, newLanguageError("unknown directive %s in Parser.Directives", name)
+		}
+		set(&q, on)
+	}
+
+	lines, kept := []string{}, []origin{}
+	for i, line := range source {
+		if isDirective[i] || q.Comments && isComment(line) {
+			continue
+		}
+		lines, kept = append(lines, line), append(kept, origins[i])
+	}
+	return strings.Join(lines, "\n"), kept, &q, nil
+}
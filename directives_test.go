@@ -0,0 +1,79 @@
+package docopt
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const directivesDoc = `#!docopt options-first strict-long comments
+Usage: prog [--verbose] <command> [<args>...]
+# <args> go to <command> as they are
+
+Options:
+  # kept for old scripts
+  --verbose  Say more.
+`
+
+func TestDirectives(t *testing.T) {
+	v, err := (&Parser{}).ParseArgs(directivesDoc, []string{"--verbose", "run", "--verbose"})
+	expect := map[string]interface{}{"--verbose": true, "<command>": "run", "<args>": []string{"--verbose"}}
+	if err != nil || !reflect.DeepEqual(v, expect) {
+		t.Error(v, err)
+	}
+	if _, _, err := (&Parser{}).parse(directivesDoc, []string{"--verb", "run"}); err == nil {
+		t.Error("--verb accepted with strict-long")
+	}
+
+	// Go overrides the doc
+	p := &Parser{Directives: map[string]bool{"strict-long": false}}
+	if v, err := p.ParseArgs(directivesDoc, []string{"--verb", "run"}); err != nil || v["--verbose"] != true {
+		t.Error(v, err)
+	}
+	p = &Parser{AbbreviateCommands: true}
+	if _, err := p.ParseArgs("#!docopt no-abbrev\nUsage: prog start", []string{"st"}); err == nil {
+		t.Error("abbreviation accepted with no-abbrev")
+	}
+
+	_, err = (&Parser{}).ParseArgs("#!docopt options-last\nUsage: prog", []string{})
+	if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+	_, err = (&Parser{Directives: map[string]bool{"no-such": true}}).ParseArgs("Usage: prog", []string{})
+	if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+}
+
+func TestCommentsLeftOutOfHelp(t *testing.T) {
+	var out bytes.Buffer
+	p := &Parser{Help: true, Stdout: &out, NoPager: true}
+	p.ParseArgs(directivesDoc, []string{"--help"})
+	expect := "Usage: prog [--verbose] <command> [<args>...]\n\nOptions:\n  --verbose  Say more.\n"
+	if out.String() != expect {
+		t.Errorf("%q", out.String())
+	}
+}
+
+func TestCommentsOff(t *testing.T) {
+	doc := `Usage: clean [--all]
+
+Examples:
+  # remove all
+  clean --all
+
+Options:
+  --all  Remove everything.`
+	var out bytes.Buffer
+	p := &Parser{Help: true, Stdout: &out, NoPager: true}
+	p.ParseArgs(doc, []string{"--help"})
+	if out.String() != doc+"\n" {
+		t.Errorf("%q", out.String())
+	}
+	out.Reset()
+	p.ParseArgs("#!docopt comments\n"+doc, []string{"--help"})
+	if strings.Contains(out.String(), "# remove all") {
+		t.Errorf("%q", out.String())
+	}
+}
@@ -13,11 +13,15 @@ package docopt
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"reflect"
 	"regexp"
 	"strings"
+	"text/template"
 	"unicode"
+	"unicode/utf8"
 )
 
 /*
@@ -49,146 +53,476 @@ func Parse(doc string, argv []string, help bool, version string,
 	if len(exit) > 0 {
 		exitOk = exit[0]
 	}
-	args, output, err := parse(doc, argv, help, version, optionsFirst)
+	p := &Parser{
+		Help:         help,
+		Version:      version,
+		OptionsFirst: optionsFirst,
+		Exit:         exitOk,
+	}
+	return p.ParseArgs(doc, argv)
+}
+
+// Parser holds the configuration used to parse `argv` against a `doc`. Its
+// zero value is ready to use; unlike Parse, it does not handle `-h` or
+// `--help` and never calls `os.Exit()` unless asked to.
+type Parser struct {
+	// Help enables automatic help messages on `-h` or `--help`.
+	Help bool
+	// Version, if non-empty, is printed when `--version` is specified.
+	Version string
+	// OptionsFirst requires that options always come before positional
+	// arguments.
+	OptionsFirst bool
+	// Exit makes ParseArgs call `os.Exit()` after printing help, the version
+	// or a user error, like Parse does by default.
+	Exit bool
+	// Limits bounds the resources spent on the doc and argv. Zero fields
+	// fall back to DefaultLimits.
+	Limits Limits
+
+	// CaseInsensitive makes commands in argv match the doc regardless of
+	// case, and long options too if FoldLongOptions is set. Two commands
+	// (or long options) of the doc that only differ in case are then a
+	// LanguageError.
+	CaseInsensitive bool
+	// Normalize, if not nil, is applied to commands (and long options if
+	// FoldLongOptions is set) of both the doc and argv before comparing
+	// them. Use norm.NFKC.String from golang.org/x/text/unicode/norm for
+	// Unicode normalization, or FoldWidth to only fold full-width forms.
+	Normalize func(string) string
+	// FoldLongOptions extends CaseInsensitive and Normalize to long options.
+	FoldLongOptions bool
+	// AbbreviateCommands accepts a prefix of a command in argv, as long as
+	// it is the prefix of no other command valid at that position.
+	AbbreviateCommands bool
+	// StrictLong requires long options in argv to be spelled out in full,
+	// instead of accepting a unique prefix such as `--verb` for `--verbose`.
+	StrictLong bool
+	// FlagValues accepts an explicit value for flags in argv, as in
+	// `--verbose=false` or `--force=yes`: one of Truthy or Falsy, in any
+	// case; DefaultTruthy and DefaultFalsy if nil. `--force yes` is still a
+	// flag followed by an argument.
+	FlagValues bool
+	Truthy     []string
+	Falsy      []string
+	// Syntax sets how options are spelled, in both the doc and argv. The
+	// zero value is the GNU convention of `--long` and clustered `-s`.
+	Syntax OptionSyntax
+
+	// FS checks the files of `[type: infile]` and `[type: outfile]` options
+	// and arguments while parsing, and opens them when they are first read
+	// or written; OSFileSystem if nil.
+	FS FileSystem
+	// Stdin and Stdout are used for files given as `-`, and ParseArgs
+	// prints help to Stdout and errors to Stderr; os.Stdin, os.Stdout and
+	// os.Stderr if nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// RenderError renders user errors for printing; ErrorFormat{}.Render if
+	// nil.
+	RenderError func(e *UserError) string
+
+	// HelpTemplate renders the help from a HelpData instead of printing
+	// the doc as it is. HelpFuncs has functions to align its columns.
+	HelpTemplate *template.Template
+
+	// Help that does not fit on the terminal is piped through Pager, run
+	// with `sh -c`; $PAGER or "less -FRX" if empty. NoPager, or setting
+	// $DOCOPT_NO_PAGER, prints it as it is.
+	Pager   string
+	NoPager bool
+	// Terminal reports the height of stdout and whether it is a terminal;
+	// it asks Stdout for its window size, or else checks $LINES, if nil.
+	Terminal func() (height int, ok bool)
+
+	// Migrations rewrite argv that does not match the doc, after those of
+	// the "migrations:" section of the doc. Deprecated is called with argv
+	// and the rewritten argv when one applies; nil prints a warning to
+	// Stderr. ShowMigration makes ParseArgs print the rewritten command
+	// instead, like it prints help.
+	Migrations    []Migration
+	Deprecated    func(argv, rewritten []string)
+	ShowMigration bool
+	migrating     bool
+
+	// DefaultCommand is inserted into argv before its first argument when
+	// argv names no command and does not match without it, so that
+	// `prog <file>` means `prog run <file>`. A command marked `[default]` in
+	// the "commands:" section of the doc is the default if empty. The
+	// result is then the same as with the command given, so Defaulted is
+	// called with the command to tell them apart.
+	DefaultCommand string
+	Defaulted      func(command string)
+
+	// Topics are extra pages of documentation by name, such as
+	// "configuration" or "exit-codes". Unless the doc matches them itself,
+	// `prog help <name>` prints a topic like `--help` prints the doc, and
+	// `prog help topics` lists them.
+	Topics map[string]string
+
+	// Fragments and Includes hold what `#include name` lines of the doc
+	// expand to: Fragments[name], or else the file name of Includes, such
+	// as an embed.FS.
+	Fragments map[string]string
+	Includes  fs.FS
+
+	// Directives turn the modes of `#!docopt` lines of the doc on or off by
+	// name, such as "options-first" or "abbrev", over what the doc says.
+	// Comments leaves the lines of the doc that are `#` alone or start with
+	// `# ` out of it, and of help.
+	Directives map[string]bool
+	Comments   bool
+}
+
+// Opts is a map of option, argument and command names to their values, as
+// returned by ParseArgs. Convert the result to Opts to close its files.
+type Opts map[string]interface{}
+
+// ParseArgs parses `argv` based on the command-line interface described in
+// `doc`, in the same way as Parse does. If `argv` is `nil`, `os.Args[1:]` is
+// used.
+//
+// The files of `[type: infile]` and `[type: outfile]` options and arguments
+// are checked, and a missing or inaccessible one is an error in argv; they
+// are opened on their first Read or Write. Close them all with
+//
+//	defer docopt.Opts(args).Close()
+func (p *Parser) ParseArgs(doc string, argv []string) (map[string]interface{}, error) {
+	args, output, err := p.parse(doc, argv)
 	if _, ok := err.(*UserError); ok {
 		// the user gave us bad input
-		fmt.Fprintln(os.Stderr, output)
-		if exitOk {
+		fmt.Fprintln(p.stderr(), output)
+		if p.Exit {
 			os.Exit(2)
 		}
 	} else if len(output) > 0 && err == nil {
 		// the user asked for help or `--version`
-		fmt.Println(output)
-		if exitOk {
+		p.printHelp(output)
+		if p.Exit {
 			os.Exit(0)
 		}
 	}
 	return args, err
 }
 
+// Check reports the errors in doc itself, such as a missing usage section or
+// unbalanced brackets, without parsing any arguments or opening files.
+func (p *Parser) Check(doc string) error {
+	_, _, err := p.parse(doc, []string{})
+	if _, ok := err.(*UserError); ok {
+		return nil
+	}
+	return err
+}
+
 // parse and return a map of args, output and all errors
-func parse(doc string, argv []string, help bool, version string, optionsFirst bool) (args map[string]interface{}, output string, err error) {
+func (p *Parser) parse(doc string, argv []string) (args map[string]interface{}, output string, err error) {
 	if argv == nil && len(os.Args) > 1 {
 		argv = os.Args[1:]
 	}
-
-	usageSections := parseSection("usage:", doc)
-
-	if len(usageSections) == 0 {
-		err = newLanguageError("\"usage:\" (case-insensitive) not found.")
+	limits := p.Limits.withDefaults()
+	if limits.exceeded(limits.Args, len(argv)) {
+		err = newLimitError("Args", "more than %d command-line arguments", limits.Args)
 		return
 	}
-	if len(usageSections) > 1 {
-		err = newLanguageError("More than one \"usage:\" (case-insensitive).")
+	c, err := p.compile(doc, limits)
+	if err != nil {
 		return
 	}
-	usage := usageSections[0]
+	defer func() { err = c.locate(err) }()
+	p, doc, usage, syntax, pat := c.parser, c.doc, c.usage, c.syntax, c.pat
+	options := c.options
+
+	if fold := p.fold(); fold != nil {
+		patFlat, _ := pat.flat(patternCommand)
+		commands := make([]string, len(patFlat))
+		for i, c := range patFlat {
+			commands[i] = c.name
+		}
+		if err = checkFolded("commands", commands, fold); err != nil {
+			return
+		}
+		if p.FoldLongOptions {
+			longs := []string{}
+			for _, o := range options {
+				if o.long != "" {
+					longs = append(longs, o.long)
+				}
+			}
+			if err = checkFolded("options", longs, fold); err != nil {
+				return
+			}
+		}
+	}
 
-	options := parseDefaults(doc)
-	formal, err := formalUsage(usage)
+	argvTokens := newTokenList(argv, errorUser)
+	argvTokens.syntax = syntax
+	argvTokens.truthy, argvTokens.falsy = p.flagWords()
+	argvTokens.strictLong = p.StrictLong
+	if p.FoldLongOptions {
+		argvTokens.fold = p.fold()
+	}
+	patternArgv, err := parseArgv(argvTokens, &options, p.OptionsFirst)
 	if err != nil {
-		output = handleError(err, usage)
+		if e, ok := err.(*UserError); ok {
+			if partialErr := p.partial(e, pat, patternArgv, argvTokens.tokens, argvTokens.unknown, nil, limits.Steps); partialErr != nil {
+				err = partialErr
+				return
+			}
+		}
+		output = p.handleError(err, usage, argv, options)
 		return
 	}
 
-	pat, err := parsePattern(formal, &options)
-	if err != nil {
-		output = handleError(err, usage)
+	if output, err = p.extras(patternArgv, doc); len(output) > 0 || err != nil {
 		return
 	}
 
-	patternArgv, err := parseArgv(newTokenList(argv, errorUser), &options, optionsFirst)
+	counters, err := parseCounters(doc, syntax)
 	if err != nil {
-		output = handleError(err, usage)
 		return
 	}
-	patFlat, err := pat.flat(patternOption)
+	repeatCounted(pat, counters)
+	types, err := parseTypes(doc, syntax)
 	if err != nil {
-		output = handleError(err, usage)
 		return
 	}
-	patternOptions := patFlat.unique()
-
-	patFlat, err = pat.flat(patternOptionSSHORTCUT)
+	migrations, err := p.migrations(doc)
 	if err != nil {
-		output = handleError(err, usage)
 		return
 	}
-	for _, optionsShortcut := range patFlat {
-		docOptions := parseDefaults(doc)
-		optionsShortcut.children = docOptions.unique().diff(patternOptions)
-	}
-
-	if output = extras(help, version, patternArgv, doc); len(output) > 0 {
+	def, err := p.defaultCommand(doc, pat)
+	if err != nil {
 		return
 	}
-
-	err = pat.fix()
-	if err != nil {
-		output = handleError(err, usage)
+	m := newMatcher(patternArgv, nil)
+	m.maxSteps = limits.Steps
+	m.fold = p.fold()
+	var abbrev *abbreviations
+	if p.AbbreviateCommands {
+		if abbrev, err = resolveAbbreviations(pat, patternArgv, m.fold, limits.Steps); err != nil {
+			return
+		}
+		m.abbrev = abbrev.commands
+	}
+	matched := m.match(pat)
+	if m.err != nil {
+		err = m.err
 		return
 	}
-	matched, left, collected := pat.match(&patternArgv, nil)
-	if matched && len(*left) == 0 {
+	defaulted := false
+	if retried, ok := withDefault(patternArgv, pat, def, m.fold); def != "" && !(matched && m.left == 0) && ok {
+		dm := newMatcher(retried, nil)
+		dm.maxSteps, dm.fold = limits.Steps, m.fold
+		if p.AbbreviateCommands {
+			var retriedAbbrev *abbreviations
+			if retriedAbbrev, err = resolveAbbreviations(pat, retried, m.fold, limits.Steps); err != nil {
+				return
+			}
+			dm.abbrev = retriedAbbrev.commands
+		}
+		if dm.match(pat) && dm.left == 0 {
+			m, matched, patternArgv, defaulted = dm, true, retried, true
+		} else if dm.err != nil {
+			err = dm.err
+			return
+		}
+	}
+	if matched && m.left == 0 {
+		var patFlat patternList
 		patFlat, err = pat.flat(patternDefault)
 		if err != nil {
-			output = handleError(err, usage)
+			output = p.handleError(err, usage, argv, options)
 			return
 		}
-		args = append(patFlat, *collected...).dictionary()
+		args = append(patFlat, m.collected...).dictionary()
+		if err = applyCounters(args, patternArgv, counters); err != nil {
+			args = nil
+			output = p.handleError(err, usage, argv, options)
+			return
+		}
+		if err = p.checkFiles(args, types); err != nil {
+			args = nil
+			output = p.handleError(err, usage, argv, options)
+			return
+		}
+		if defaulted && p.Defaulted != nil {
+			p.Defaulted(def)
+		}
+		p.openFiles(args, types)
 		return
 	}
 
+	if topic, ok, topicErr := p.topicHelp(argv); ok {
+		output, err = topic, topicErr
+		if err != nil {
+			output = p.handleError(err, usage, argv, options)
+		}
+		return
+	}
+	if rewritten, ok := syntax.migrate(migrations, argv, options); ok && !p.migrating {
+		q := *p
+		q.migrating = true
+		if newArgs, newOutput, newErr := q.parse(doc, rewritten); newErr == nil {
+			prog, _ := relevantUsage(usage, nil, syntax)
+			if p.ShowMigration {
+				Opts(newArgs).Close()
+				return nil, commandLine(prog, rewritten), nil
+			}
+			p.deprecated(prog, argv, rewritten)
+			return newArgs, newOutput, nil
+		}
+	}
 	err = newUserError("")
-	output = handleError(err, usage)
+	if len(argvTokens.unknown) > 0 {
+		err = newUserError("unknown option %s", argvTokens.unknown[0])
+	} else if abbrev != nil {
+		if e := abbrev.err(patternArgv); e != nil {
+			err = e
+		}
+	}
+	if e, ok := err.(*UserError); ok {
+		if partialErr := p.partial(e, pat, patternArgv, nil, argvTokens.unknown, m.abbrev, limits.Steps); partialErr != nil {
+			err = partialErr
+			return
+		}
+	}
+	output = p.handleError(err, usage, argv, options)
 	return
 }
 
-func handleError(err error, usage string) string {
-	if _, ok := err.(*UserError); ok {
-		return strings.TrimSpace(fmt.Sprintf("%s\n%s", err, usage))
+// handleError fills in the details of a UserError and renders it for the
+// user; other errors are not shown to the user.
+func (p *Parser) handleError(err error, usage string, argv []string, options patternList) string {
+	e, ok := err.(*UserError)
+	if !ok {
+		return ""
 	}
-	return ""
+	e.Usage = usage
+	e.Prog, e.UsageLines = relevantUsage(usage, argv, p.Syntax.withDefaults())
+	if p.Help {
+		for _, o := range options {
+			if o.long == "--help" {
+				e.HelpFlag = o.long
+			} else if o.short == "-h" && e.HelpFlag == "" {
+				e.HelpFlag = o.short
+			}
+		}
+	}
+	if p.RenderError != nil {
+		return p.RenderError(e)
+	}
+	return ErrorFormat{}.Render(e)
 }
 
+// parseSection returns every section of source that starts on a line
+// containing name (case-insensitive) and continues over the following
+// indented lines. It works line by line, in time linear in source.
 func parseSection(name, source string) []string {
-	p := regexp.MustCompile(`(?im)^([^\n]*` + name + `[^\n]*\n?(?:[ \t].*?(?:\n|$))*)`)
-	s := p.FindAllString(source, -1)
-	if s == nil {
-		s = []string{}
-	}
-	for i, v := range s {
-		s[i] = strings.TrimSpace(v)
+	sections, _ := sectionsAt(name, source)
+	return sections
+}
+
+// sectionsAt returns the sections parseSection does, and the offset of each
+// in source.
+func sectionsAt(name, source string) ([]string, []int) {
+	p := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(name))
+	lines := strings.Split(source, "\n")
+	s, offsets := []string{}, []int{}
+	offset := 0
+	for i := 0; i < len(lines); {
+		if !p.MatchString(lines[i]) {
+			offset += len(lines[i]) + 1
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(lines) && (strings.HasPrefix(lines[j], " ") || strings.HasPrefix(lines[j], "\t")) {
+			j++
+		}
+		section := strings.Join(lines[i:j], "\n")
+		s = append(s, strings.TrimSpace(section))
+		offsets = append(offsets, offset+len(section)-len(strings.TrimLeftFunc(section, unicode.IsSpace)))
+		offset += len(section) + 1
+		i = j
 	}
-	return s
+	return s, offsets
 }
 
 func parseDefaults(doc string) patternList {
+	return defaultSyntax.parseDefaults(doc)
+}
+
+func (syntax OptionSyntax) parseDefaults(doc string) patternList {
 	defaults := patternList{}
-	p := regexp.MustCompile(`\n[ \t]*(-\S+?)`)
-	for _, s := range parseSection("options:", doc) {
-		// FIXME corner case "bla: options: --foo"
-		_, _, s = stringPartition(s, ":") // get rid of "options:"
-		split := p.Split("\n"+s, -1)[1:]
-		match := p.FindAllStringSubmatch("\n"+s, -1)
-		for i := range split {
-			optionDescription := match[i][1] + split[i]
-			if strings.HasPrefix(optionDescription, "-") {
-				defaults = append(defaults, parseOption(optionDescription))
-			}
-		}
+	for _, optionDescription := range syntax.optionDescriptions(doc) {
+		defaults = append(defaults, syntax.parseOption(optionDescription))
 	}
 	return defaults
 }
 
+// optionDescriptions returns the entries of the "options:" sections of doc.
+func (syntax OptionSyntax) optionDescriptions(doc string) []string {
+	descriptions, _ := syntax.optionDescriptionsAt(doc)
+	return descriptions
+}
+
+// optionDescriptionsAt returns the entries optionDescriptions does, and the
+// offset of each in doc.
+func (syntax OptionSyntax) optionDescriptionsAt(doc string) ([]string, []int) {
+	descriptions, offsets := []string{}, []int{}
+	sections, at := sectionsAt("options:", doc)
+	for i, s := range sections {
+		d, o := syntax.sectionOptionsAt(s)
+		descriptions = append(descriptions, d...)
+		for _, offset := range o {
+			offsets = append(offsets, at[i]+offset)
+		}
+	}
+	return descriptions, offsets
+}
+
+// sectionOptions returns the entries of a single "options:" section.
+func (syntax OptionSyntax) sectionOptions(section string) []string {
+	descriptions, _ := syntax.sectionOptionsAt(section)
+	return descriptions
+}
+
+// sectionOptionsAt returns the entries sectionOptions does, and the offset
+// of each in section.
+func (syntax OptionSyntax) sectionOptionsAt(section string) ([]string, []int) {
+	descriptions, offsets := []string{}, []int{}
+	p := regexp.MustCompile(`\n[ \t]*(` + syntax.prefixPattern() + `\S+?)`)
+	// FIXME corner case "bla: options: --foo"
+	_, _, s := stringPartition(section, ":") // get rid of "options:"
+	// "\n"+s starts at start in section
+	start := len(section) - len(s) - 1
+	split := p.Split("\n"+s, -1)[1:]
+	match := p.FindAllStringSubmatchIndex("\n"+s, -1)
+	for i := range split {
+		optionDescription := ("\n" + s)[match[i][2]:match[i][3]] + split[i]
+		if syntax.isOption(optionDescription) {
+			descriptions = append(descriptions, optionDescription)
+			offsets = append(offsets, start+match[i][2])
+		}
+	}
+	return descriptions, offsets
+}
+
 func parsePattern(source string, options *patternList) (*pattern, error) {
-	tokens := tokenListFromPattern(source)
+	return parsePatternTokens(tokenListFromPattern(source), options)
+}
+
+func parsePatternTokens(tokens *tokenList, options *patternList) (*pattern, error) {
 	result, err := parseExpr(tokens, options)
 	if err != nil {
 		return nil, err
 	}
 	if tokens.current() != nil {
-		return nil, tokens.errorFunc("unexpected ending: %s" + strings.Join(tokens.tokens, " "))
+		at := tokens.offset()
+		return nil, errorAt(tokens.errorFunc("unexpected ending: %s", strings.Join(tokens.tokens, " ")), at)
 	}
 	return newRequired(result...), nil
 }
@@ -201,26 +535,45 @@ func parseArgv(tokens *tokenList, options *patternList, optionsFirst bool) (patt
 			argv ::= [ long | shorts ]* [ argument ]* [ '--' [ argument ]* ] ;
 		else:
 			argv ::= [ long | shorts | argument ]* [ '--' [ argument ]* ] ;
+
+		On an error, it returns what it parsed before the word that failed,
+		and leaves tokens at that word.
 	*/
 	parsed := patternList{}
+	var rest []string
+	// fail leaves tokens at the word that failed, with what was parsed
+	// before it
+	fail := func(err error) (patternList, error) {
+		tokens.tokens = rest
+		return parsed, err
+	}
 	for tokens.current() != nil {
+		rest = tokens.tokens
 		if tokens.current().eq("--") {
 			for _, v := range tokens.tokens {
 				parsed = append(parsed, newArgument("", v))
 			}
 			return parsed, nil
-		} else if tokens.current().hasPrefix("--") {
+		} else if tokens.syntax.isLong(tokens.current().String()) {
 			pl, err := parseLong(tokens, options)
 			if err != nil {
-				return nil, err
+				return fail(err)
 			}
 			parsed = append(parsed, pl...)
-		} else if tokens.current().hasPrefix("-") && !tokens.current().eq("-") {
+		} else if tokens.syntax.isStrayLong(tokens.current().String()) {
+			return fail(tokens.errorFunc("unknown option %s: long options start with %s", tokens.current(), tokens.syntax.Long))
+		} else if tokens.syntax.isShort(tokens.current().String()) {
 			ps, err := parseShorts(tokens, options)
 			if err != nil {
-				return nil, err
+				return fail(err)
 			}
 			parsed = append(parsed, ps...)
+		} else if tokens.syntax.isNegated(tokens.current().String()) {
+			pn, err := parseNegated(tokens, options)
+			if err != nil {
+				return fail(err)
+			}
+			parsed = append(parsed, pn...)
 		} else if optionsFirst {
 			for _, v := range tokens.tokens {
 				parsed = append(parsed, newArgument("", v))
@@ -234,6 +587,10 @@ func parseArgv(tokens *tokenList, options *patternList, optionsFirst bool) (patt
 }
 
 func parseOption(optionDescription string) *pattern {
+	return defaultSyntax.parseOption(optionDescription)
+}
+
+func (syntax OptionSyntax) parseOption(optionDescription string) *pattern {
 	optionDescription = strings.TrimSpace(optionDescription)
 	options, _, description := stringPartition(optionDescription, "  ")
 	options = strings.Replace(options, ",", " ", -1)
@@ -242,15 +599,23 @@ func parseOption(optionDescription string) *pattern {
 	short := ""
 	long := ""
 	argcount := 0
+	negatable := false
 	var value interface{}
 	value = false
 
+	description = reType.ReplaceAllString(description, "")
+	description = reCounter.ReplaceAllString(description, "")
 	reDefault := regexp.MustCompile(`(?i)\[default: (.*)\]`)
 	for _, s := range strings.Fields(options) {
-		if strings.HasPrefix(s, "--") {
+		if syntax.isLong(s) {
 			long = s
-		} else if strings.HasPrefix(s, "-") {
+		} else if syntax.isShort(s) {
 			short = s
+		} else if syntax.isNegated(s) {
+			negatable = true
+			if n, l := syntax.unnegate(s); short == "" && long == "" {
+				short, long = n, l
+			}
 		} else {
 			argcount = 1
 		}
@@ -263,7 +628,9 @@ func parseOption(optionDescription string) *pattern {
 			}
 		}
 	}
-	return newOption(short, long, argcount, value)
+	opt := newOption(short, long, argcount, value)
+	opt.negatable = negatable
+	return opt
 }
 
 func parseExpr(tokens *tokenList, options *patternList) (patternList, error) {
@@ -283,6 +650,10 @@ func parseExpr(tokens *tokenList, options *patternList) (patternList, error) {
 	}
 	for tokens.current().eq("|") {
 		tokens.move()
+		tokens.alternatives++
+		if tokens.limits.exceeded(tokens.limits.Alternatives, tokens.alternatives) {
+			return nil, newLimitError("Alternatives", "more than %d alternatives in usage", tokens.limits.Alternatives)
+		}
 		seq, err = parseSeq(tokens, options)
 		if err != nil {
 			return nil, err
@@ -321,12 +692,18 @@ func parseAtom(tokens *tokenList, options *patternList) (patternList, error) {
 	tok := tokens.current()
 	result := patternList{}
 	if tokens.current().match(false, "(", "[") {
+		open := tokens.offset()
 		tokens.move()
+		tokens.depth++
+		if tokens.limits.exceeded(tokens.limits.Depth, tokens.depth) {
+			return nil, newLimitError("Depth", "usage is nested more than %d levels deep", tokens.limits.Depth)
+		}
 		var matching string
 		pl, err := parseExpr(tokens, options)
 		if err != nil {
 			return nil, err
 		}
+		tokens.depth--
 		if tok.eq("(") {
 			matching = ")"
 			result = patternList{newRequired(pl...)}
@@ -335,17 +712,24 @@ func parseAtom(tokens *tokenList, options *patternList) (patternList, error) {
 			result = patternList{newOptional(pl...)}
 		}
 		moved := tokens.move()
+		if tokens.inserted[tokens.moved] && !tokens.inserted[open] {
+			moved = nil // the end of a usage line closes no bracket
+		}
 		if !moved.eq(matching) {
-			return nil, tokens.errorFunc("unmatched '%s', expected: '%s' got: '%s'", tok, matching, moved)
+			return nil, errorAt(tokens.errorFunc("unmatched '%s', expected: '%s' got: '%s'", tok, matching, moved), open)
 		}
 		return result, nil
 	} else if tok.eq("options") {
 		tokens.move()
 		return patternList{newOptionsShortcut()}, nil
-	} else if tok.hasPrefix("--") && !tok.eq("--") {
+	} else if tokens.syntax.isLong(tok.String()) {
 		return parseLong(tokens, options)
-	} else if tok.hasPrefix("-") && !tok.eq("-") && !tok.eq("--") {
+	} else if tokens.syntax.isStrayLong(tok.String()) {
+		return nil, tokens.errorFunc("%s is not an option: long options start with %s", tok, tokens.syntax.Long)
+	} else if tokens.syntax.isShort(tok.String()) {
 		return parseShorts(tokens, options)
+	} else if tokens.syntax.isNegated(tok.String()) {
+		return parseNegated(tokens, options)
 	} else if tok.hasPrefix("<") && tok.hasSuffix(">") || tok.isUpper() {
 		return patternList{newArgument(tokens.move().String(), nil)}, nil
 	}
@@ -363,19 +747,23 @@ func parseLong(tokens *tokenList, options *patternList) (patternList, error) {
 		value = v
 	}
 
-	if !strings.HasPrefix(long, "--") {
-		return nil, newError("long option '%s' doesn't start with --", long)
+	if !strings.HasPrefix(long, tokens.syntax.Long) {
+		return nil, newError("long option '%s' doesn't start with %s", long, tokens.syntax.Long)
+	}
+	folded := long
+	if tokens.fold != nil {
+		folded = tokens.fold(long)
 	}
 	similar := patternList{}
 	for _, o := range *options {
-		if o.long == long {
+		if o.long == long || tokens.fold != nil && o.long != "" && tokens.fold(o.long) == folded {
 			similar = append(similar, o)
 		}
 	}
-	if tokens.err == errorUser && len(similar) == 0 { // if no exact match
+	if tokens.err == errorUser && len(similar) == 0 && !tokens.strictLong { // if no exact match
 		similar = patternList{}
 		for _, o := range *options {
-			if strings.HasPrefix(o.long, long) {
+			if strings.HasPrefix(o.long, long) || tokens.fold != nil && o.long != "" && strings.HasPrefix(tokens.fold(o.long), folded) {
 				similar = append(similar, o)
 			}
 		}
@@ -394,6 +782,7 @@ func parseLong(tokens *tokenList, options *patternList) (patternList, error) {
 		opt = newOption("", long, argcount, false)
 		*options = append(*options, opt)
 		if tokens.err == errorUser {
+			tokens.unknown = append(tokens.unknown, long)
 			var val interface{}
 			if argcount > 0 {
 				val = value
@@ -406,7 +795,11 @@ func parseLong(tokens *tokenList, options *patternList) (patternList, error) {
 		opt = newOption(similar[0].short, similar[0].long, similar[0].argcount, similar[0].value)
 		if opt.argcount == 0 {
 			if value != nil {
-				return nil, tokens.errorFunc("%s must not have an argument", opt.long)
+				b, err := tokens.flagValue(opt.long, value.(string))
+				if err != nil {
+					return nil, err
+				}
+				value = b
 			}
 		} else {
 			if value == nil {
@@ -434,15 +827,17 @@ func parseLong(tokens *tokenList, options *patternList) (patternList, error) {
 func parseShorts(tokens *tokenList, options *patternList) (patternList, error) {
 	// shorts ::= '-' ( chars )* [ [ ' ' ] chars ] ;
 	tok := tokens.move()
-	if !tok.hasPrefix("-") || tok.hasPrefix("--") {
-		return nil, newError("short option '%s' doesn't start with -", tok)
+	if !tokens.syntax.isShort(tok.String()) {
+		return nil, newError("short option '%s' doesn't start with %s", tok, tokens.syntax.Short)
 	}
-	left := strings.TrimLeft(tok.String(), "-")
+	left := strings.TrimPrefix(tok.String(), tokens.syntax.Short)
 	parsed := patternList{}
 	for left != "" {
 		var opt *pattern
-		short := "-" + left[0:1]
-		left = left[1:]
+		// split on runes, but pass bytes that are not valid UTF-8 one by one
+		_, size := utf8.DecodeRuneInString(left)
+		short := tokens.syntax.Short + left[:size]
+		left = left[size:]
 		similar := patternList{}
 		for _, o := range *options {
 			if o.short == short {
@@ -455,6 +850,7 @@ func parseShorts(tokens *tokenList, options *patternList) (patternList, error) {
 			opt = newOption(short, "", 0, false)
 			*options = append(*options, opt)
 			if tokens.err == errorUser {
+				tokens.unknown = append(tokens.unknown, short)
 				opt = newOption(short, "", 0, true)
 			}
 		} else { // why copying is necessary here?
@@ -491,7 +887,8 @@ func newTokenList(source []string, err errorType) *tokenList {
 	} else if err == errorLanguage {
 		errorFunc = newLanguageError
 	}
-	return &tokenList{source, errorFunc, err}
+	return &tokenList{tokens: source, errorFunc: errorFunc, err: err,
+		limits: DefaultLimits, syntax: defaultSyntax}
 }
 
 func tokenListFromString(source string) *tokenList {
@@ -525,35 +922,38 @@ func formalUsage(section string) (string, error) {
 		return "", newLanguageError("no fields found in usage (perhaps a spacing error).")
 	}
 
-	result := "( "
+	result := []string{"("}
 	for _, s := range pu[1:] {
 		if s == pu[0] {
-			result += ") | ( "
+			result = append(result, ") | (")
 		} else {
-			result += s + " "
+			result = append(result, s)
 		}
 	}
-	result += ")"
+	result = append(result, ")")
 
-	return result, nil
+	return strings.Join(result, " "), nil
 }
 
-func extras(help bool, version string, options patternList, doc string) string {
-	if help {
+func (p *Parser) extras(options patternList, doc string) (string, error) {
+	if p.Help {
+		if keyword, ok := helpKeyword(options); ok {
+			return p.searchHelp(doc, keyword), nil
+		}
 		for _, o := range options {
 			if (o.name == "-h" || o.name == "--help") && o.value == true {
-				return strings.Trim(doc, "\n")
+				return p.helpText(doc)
 			}
 		}
 	}
-	if version != "" {
+	if p.Version != "" {
 		for _, o := range options {
 			if (o.name == "--version") && o.value == true {
-				return version
+				return p.Version, nil
 			}
 		}
 	}
-	return ""
+	return "", nil
 }
 
 type errorType int
@@ -575,27 +975,122 @@ func (e errorType) String() string {
 
 // UserError records an error with program arguments.
 type UserError struct {
-	msg   string
+	msg string
+	// Usage is the usage section of the doc.
 	Usage string
+	// Prog is the name of the program, from the usage section.
+	Prog string
+	// UsageLines are the usage patterns that start with the same commands
+	// as argv, or all of them if none do.
+	UsageLines []string
+	// HelpFlag is the option that shows help, if the parser handles one.
+	HelpFlag string
+
+	// Partial holds what was recognized of argv when it matched no usage
+	// pattern, or could not be parsed: the commands and arguments of the
+	// closest pattern, and the options. Leftover are the arguments that fit
+	// nowhere in that pattern, the unknown options, and the words from one
+	// that could not be parsed on.
+	Partial  Opts
+	Leftover []string
 }
 
 func (e UserError) Error() string {
 	return e.msg
 }
 func newUserError(msg string, f ...interface{}) error {
-	return &UserError{fmt.Sprintf(msg, f...), ""}
+	return &UserError{msg: fmt.Sprintf(msg, f...)}
 }
 
 // LanguageError records an error with the doc string.
 type LanguageError struct {
 	msg string
+	// File and Line locate the error in a fragment the doc includes, or
+	// Line in the doc itself if File is empty. Line is zero if the error is
+	// not on a particular line, such as a missing usage section. Column
+	// counts bytes from 1, and is zero if the error is about the whole line.
+	File   string
+	Line   int
+	Column int
+
+	at int // offset of the error in the doc being parsed, plus one
 }
 
 func (e LanguageError) Error() string {
-	return e.msg
+	if e.File == "" {
+		return e.msg
+	}
+	return origin{e.File, e.Line}.String() + ": " + e.msg
 }
 func newLanguageError(msg string, f ...interface{}) error {
-	return &LanguageError{fmt.Sprintf(msg, f...)}
+	return &LanguageError{msg: fmt.Sprintf(msg, f...)}
+}
+
+// errorAt sets the offset in the doc of err, if it is a LanguageError.
+func errorAt(err error, offset int) error {
+	if e, ok := err.(*LanguageError); ok && offset >= 0 {
+		e.at = offset + 1
+	}
+	return err
+}
+
+// LimitError records that the doc or argv exceeded one of the Limits.
+type LimitError struct {
+	msg string
+	// Limit is the name of the exceeded field of Limits.
+	Limit string
+}
+
+func (e LimitError) Error() string {
+	return e.msg
+}
+func newLimitError(limit string, msg string, f ...interface{}) error {
+	return &LimitError{fmt.Sprintf(msg, f...), limit}
+}
+
+// Limits bounds the resources spent on parsing a doc and matching argv
+// against it, so that both may come from untrusted sources. A zero field
+// means the value from DefaultLimits; a negative one disables the limit.
+type Limits struct {
+	DocSize      int // length of the doc in bytes
+	Depth        int // nesting of ( ) and [ ] groups in usage patterns
+	Alternatives int // number of | alternatives, including usage lines
+	Args         int // number of elements in argv
+	Steps        int // number of pattern nodes visited while matching
+}
+
+// DefaultLimits are the limits used by Parse, and for zero fields of
+// Parser.Limits.
+var DefaultLimits = Limits{
+	DocSize:      1 << 20,
+	Depth:        256,
+	Alternatives: 1 << 14,
+	Args:         1 << 20,
+	Steps:        1 << 26,
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.DocSize == 0 {
+		l.DocSize = DefaultLimits.DocSize
+	}
+	if l.Depth == 0 {
+		l.Depth = DefaultLimits.Depth
+	}
+	if l.Alternatives == 0 {
+		l.Alternatives = DefaultLimits.Alternatives
+	}
+	if l.Args == 0 {
+		l.Args = DefaultLimits.Args
+	}
+	if l.Steps == 0 {
+		l.Steps = DefaultLimits.Steps
+	}
+	return l
+}
+
+// exceeded reports whether n is over limit; negative limits are disabled.
+func (l Limits) exceeded(limit, n int) bool {
+	return limit > 0 && n > limit
 }
 
 var newError = fmt.Errorf
@@ -604,6 +1099,24 @@ type tokenList struct {
 	tokens    []string
 	errorFunc func(string, ...interface{}) error
 	err       errorType
+
+	limits       Limits
+	depth        int
+	alternatives int
+
+	// offsets in the doc of the tokens of a usage pattern, and of the
+	// token moved past last, for errors; inserted are those of the
+	// parentheses around each usage line
+	offsets  []int
+	moved    int
+	inserted map[int]bool
+
+	fold       func(string) string // applied to long options before comparing
+	strictLong bool                // no prefixes of long options
+	syntax     OptionSyntax
+	unknown    []string // options in argv that are not in the doc
+	// values of flags given as `--flag=value`, nil if not allowed
+	truthy, falsy []string
 }
 type token string
 
@@ -664,6 +1177,9 @@ func (tl *tokenList) length() int {
 }
 
 func (tl *tokenList) move() *token {
+	if len(tl.offsets) > 0 {
+		tl.moved, tl.offsets = tl.offsets[0], tl.offsets[1:]
+	}
 	if len(tl.tokens) > 0 {
 		t := tl.tokens[0]
 		tl.tokens = tl.tokens[1:]
@@ -672,6 +1188,18 @@ func (tl *tokenList) move() *token {
 	return nil
 }
 
+// offset returns the offset in the doc of the current token, or of the last
+// one if there are no more; -1 if the tokens are not from the doc.
+func (tl *tokenList) offset() int {
+	if len(tl.offsets) > 0 {
+		return tl.offsets[0]
+	}
+	if tl.offsets == nil {
+		return -1
+	}
+	return tl.moved
+}
+
 type patternType uint
 
 const (
@@ -740,6 +1268,8 @@ type pattern struct {
 	short    string
 	long     string
 	argcount int
+
+	negatable bool // may be turned off with OptionSyntax.Negate
 }
 
 type patternList []*pattern
@@ -845,6 +1375,44 @@ func (p *pattern) flat(types patternType) (patternList, error) {
 	return nil, newError("unknown pattern type: %d, %d", p.t, types)
 }
 
+// simplify flattens the redundant branches of p without changing what it
+// matches: Required, Optional and Either children of a branch of the same
+// type are merged into it, a Required or Either of one child is replaced by
+// the child, and so is an Optional around [options] or another Optional.
+func (p *pattern) simplify() *pattern {
+	if p.t&patternBranch == 0 {
+		return p
+	}
+	children := patternList{}
+	for _, child := range p.children {
+		child = child.simplify()
+		if child.t == p.t && p.t&(patternRequired|patternOptionAL|patternEither) != 0 {
+			children = append(children, child.children...)
+		} else {
+			children = append(children, child)
+		}
+	}
+	p.children = children
+	if len(children) == 1 {
+		switch {
+		case p.t&(patternRequired|patternEither) != 0:
+			return children[0]
+		case p.t&patternOptionAL != 0 && children[0].t&(patternOptionAL|patternOptionSSHORTCUT) != 0:
+			return children[0]
+		}
+	}
+	return p
+}
+
+// simplified returns p simplified, as a Required.
+func (p *pattern) simplified() *pattern {
+	s := p.simplify()
+	if s.t&patternRequired == 0 {
+		s = newRequired(s)
+	}
+	return s
+}
+
 func (p *pattern) fix() error {
 	err := p.fixIdentities(nil)
 	if err != nil {
@@ -866,15 +1434,25 @@ func (p *pattern) fixIdentities(uniq patternList) error {
 		}
 		uniq = pFlat.unique()
 	}
+	byString := make(map[string]*pattern, len(uniq))
+	for _, u := range uniq {
+		if _, ok := byString[u.String()]; !ok {
+			byString[u.String()] = u
+		}
+	}
+	return p.fixIdentitiesIn(byString)
+}
+
+func (p *pattern) fixIdentitiesIn(uniq map[string]*pattern) error {
 	for i, child := range p.children {
 		if child.t&patternBranch == 0 {
-			ind, err := uniq.index(child)
-			if err != nil {
-				return err
+			u, ok := uniq[child.String()]
+			if !ok {
+				return newError("%s not in list", child)
 			}
-			p.children[i] = uniq[ind]
+			p.children[i] = u
 		} else {
-			err := child.fixIdentities(uniq)
+			err := child.fixIdentitiesIn(uniq)
 			if err != nil {
 				return err
 			}
@@ -885,184 +1463,361 @@ func (p *pattern) fixIdentities(uniq patternList) error {
 
 func (p *pattern) fixRepeatingArguments() {
 	// Fix elements that should accumulate/increment values.
-	var either []patternList
-
-	for _, child := range p.transform().children {
-		either = append(either, child.children)
+	//
+	// This is equivalent to looking for elements that occur more than once
+	// in a case of p.transform(), without expanding the pattern: the
+	// expansion grows exponentially with the number of alternatives.
+	repeats := p.repeats()
+	leaves, _ := p.flat(patternDefault)
+	casMultiple := patternList{}
+	for _, e := range leaves {
+		if repeats[e.String()] > 1 {
+			casMultiple = append(casMultiple, e)
+		}
 	}
-	for _, cas := range either {
-		casMultiple := patternList{}
-		for _, e := range cas {
-			if cas.count(e) > 1 {
-				casMultiple = append(casMultiple, e)
+	for _, e := range casMultiple {
+		if e.t == patternArgument || e.t == patternOption && e.argcount > 0 {
+			switch e.value.(type) {
+			case string:
+				e.value = strings.Fields(e.value.(string))
+			case []string:
+			default:
+				e.value = []string{}
 			}
 		}
-		for _, e := range casMultiple {
-			if e.t == patternArgument || e.t == patternOption && e.argcount > 0 {
-				switch e.value.(type) {
-				case string:
-					e.value = strings.Fields(e.value.(string))
-				case []string:
-				default:
-					e.value = []string{}
+		if e.t == patternCommand || e.t == patternOption && e.argcount == 0 {
+			e.value = 0
+		}
+	}
+}
+
+// repeats returns how many times each leaf of p (by its String()) occurs in
+// the case of p.transform() where it occurs most, counting up to 2.
+func (p *pattern) repeats() map[string]int {
+	if p.t&patternLeaf != 0 {
+		return map[string]int{p.String(): 1}
+	}
+	result := make(map[string]int)
+	for _, child := range p.children {
+		for k, n := range child.repeats() {
+			if p.t&patternEither != 0 {
+				if n > result[k] {
+					result[k] = n
 				}
-			}
-			if e.t == patternCommand || e.t == patternOption && e.argcount == 0 {
-				e.value = 0
+			} else {
+				result[k] += n
 			}
 		}
 	}
+	for k, n := range result {
+		if p.t&patternOneOrMore != 0 {
+			n *= 2
+		}
+		if n > 2 {
+			n = 2
+		}
+		result[k] = n
+	}
+	return result
 }
 
+// match reports whether p matches the argv elements in left, and returns what
+// is left unmatched together with the collected values. It is a convenience
+// wrapper around matcher for matching a single pattern.
 func (p *pattern) match(left *patternList, collected *patternList) (bool, *patternList, *patternList) {
 	if collected == nil {
 		collected = &patternList{}
 	}
+	m := newMatcher(*left, *collected)
+	if !m.match(p) {
+		return false, left, collected
+	}
+	remaining := m.remaining()
+	return true, &remaining, &m.collected
+}
+
+/*
+matcher holds the state of matching a pattern against parsed argv.
+
+Instead of copying the list of unmatched argv elements (and the collected
+values) on every leaf match, it keeps a cursor into argv for positional
+arguments and one for each option name, and records every change it makes on
+a trail. A branch that fails to match is undone by unwinding the trail back to
+a mark, so the cost of matching is proportional to the work actually done
+rather than to the length of argv at every step.
+*/
+type matcher struct {
+	argv     patternList
+	consumed []bool
+	left     int
+
+	positional []int            // indexes of arguments in argv
+	named      map[string][]int // indexes of argv elements by name
+	cursors    map[string]int   // next candidate in positional ("") or named
+
+	collected patternList
+	sameName  map[string]*pattern // first collected pattern with a name
+
+	trail []matchUndo
+
+	steps    int
+	maxSteps int   // see Limits.Steps
+	err      error // set when matching was aborted
+
+	fold   func(string) string // applied to commands before comparing
+	abbrev map[int]string      // argv index to the command it abbreviates
+}
+
+type undoType int
+
+const (
+	undoConsume undoType = iota
+	undoCursor
+	undoSameName
+	undoValue
+)
+
+// matchUndo records a single change to the matcher state.
+type matchUndo struct {
+	t     undoType
+	index int // argv index for undoConsume, old cursor for undoCursor
+	key   string
+	p     *pattern
+	value interface{}
+}
+
+// matchMark is a point in the matcher history that can be rolled back to.
+type matchMark struct {
+	trail     int
+	collected int
+}
+
+func newMatcher(argv patternList, collected patternList) *matcher {
+	m := &matcher{
+		argv:      argv,
+		consumed:  make([]bool, len(argv)),
+		left:      len(argv),
+		named:     make(map[string][]int),
+		cursors:   make(map[string]int),
+		collected: make(patternList, 0, len(collected)+len(argv)),
+		sameName:  make(map[string]*pattern),
+	}
+	for i, a := range argv {
+		if a.t&patternArgument != 0 {
+			m.positional = append(m.positional, i)
+		}
+		if a.name != "" {
+			m.named[a.name] = append(m.named[a.name], i)
+		}
+	}
+	for _, c := range collected {
+		m.collect(c)
+	}
+	return m
+}
+
+func (m *matcher) mark() matchMark {
+	return matchMark{len(m.trail), len(m.collected)}
+}
+
+func (m *matcher) rollback(mark matchMark) {
+	for i := len(m.trail) - 1; i >= mark.trail; i-- {
+		u := m.trail[i]
+		switch u.t {
+		case undoConsume:
+			m.consumed[u.index] = false
+			m.left++
+		case undoCursor:
+			m.cursors[u.key] = u.index
+		case undoSameName:
+			delete(m.sameName, u.key)
+		case undoValue:
+			u.p.value = u.value
+		}
+	}
+	m.trail = m.trail[:mark.trail]
+	m.collected = m.collected[:mark.collected]
+}
+
+// remaining returns the argv elements that have not been matched.
+func (m *matcher) remaining() patternList {
+	result := make(patternList, 0, m.left)
+	for i, a := range m.argv {
+		if !m.consumed[i] {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// next returns the argv index of the first unmatched element of queue, or -1.
+func (m *matcher) next(key string, queue []int) int {
+	old := m.cursors[key]
+	i := old
+	for i < len(queue) && m.consumed[queue[i]] {
+		i++
+	}
+	if i != old {
+		m.trail = append(m.trail, matchUndo{t: undoCursor, index: old, key: key})
+		m.cursors[key] = i
+	}
+	if i == len(queue) {
+		return -1
+	}
+	return queue[i]
+}
+
+func (m *matcher) consume(i int) {
+	m.consumed[i] = true
+	m.left--
+	m.trail = append(m.trail, matchUndo{t: undoConsume, index: i})
+}
+
+func (m *matcher) collect(p *pattern) {
+	if _, ok := m.sameName[p.name]; !ok {
+		m.sameName[p.name] = p
+		m.trail = append(m.trail, matchUndo{t: undoSameName, key: p.name})
+	}
+	m.collected = append(m.collected, p)
+}
+
+func (m *matcher) setValue(p *pattern, value interface{}) {
+	m.trail = append(m.trail, matchUndo{t: undoValue, p: p, value: p.value})
+	p.value = value
+}
+
+// match reports whether p matches at the current state. If it does not, the
+// state is left unchanged.
+func (m *matcher) match(p *pattern) bool {
+	if m.err != nil {
+		return false
+	}
+	m.steps++
+	if m.maxSteps > 0 && m.steps > m.maxSteps {
+		m.err = newLimitError("Steps", "matching took more than %d steps", m.maxSteps)
+		return false
+	}
 	if p.t&patternRequired != 0 {
-		l := left
-		c := collected
-		for _, p := range p.children {
-			var matched bool
-			matched, l, c = p.match(l, c)
-			if !matched {
-				return false, left, collected
+		mark := m.mark()
+		for _, child := range p.children {
+			if !m.match(child) {
+				m.rollback(mark)
+				return false
 			}
 		}
-		return true, l, c
+		return true
 	} else if p.t&patternOptionAL != 0 || p.t&patternOptionSSHORTCUT != 0 {
-		for _, p := range p.children {
-			_, left, collected = p.match(left, collected)
+		for _, child := range p.children {
+			m.match(child)
 		}
-		return true, left, collected
+		return true
 	} else if p.t&patternOneOrMore != 0 {
 		if len(p.children) != 1 {
 			panic("OneOrMore.match(): assert len(p.children) == 1")
 		}
-		l := left
-		c := collected
-		var lAlt *patternList
-		matched := true
 		times := 0
-		for matched {
-			// could it be that something didn't match but changed l or c?
-			matched, l, c = p.children[0].match(l, c)
-			if matched {
-				times++
+		for {
+			left := m.left
+			if !m.match(p.children[0]) {
+				break
 			}
-			if lAlt == l {
+			times++
+			if m.left == left {
 				break
 			}
-			lAlt = l
-		}
-		if times >= 1 {
-			return true, l, c
 		}
-		return false, left, collected
+		return times >= 1
 	} else if p.t&patternEither != 0 {
-		type outcomeStruct struct {
-			matched   bool
-			left      *patternList
-			collected *patternList
-			length    int
-		}
-		outcomes := []outcomeStruct{}
-		for _, p := range p.children {
-			matched, l, c := p.match(left, collected)
-			outcome := outcomeStruct{matched, l, c, len(*l)}
-			if matched {
-				outcomes = append(outcomes, outcome)
-			}
-		}
-		if len(outcomes) > 0 {
-			minLen := outcomes[0].length
-			minIndex := 0
-			for i, v := range outcomes {
-				if v.length < minLen {
-					minIndex = i
+		// Pick the first child that leaves the fewest argv elements unmatched.
+		mark := m.mark()
+		best, bestLeft := -1, 0
+		for i, child := range p.children {
+			if m.match(child) && (best < 0 || m.left < bestLeft) {
+				best, bestLeft = i, m.left
+				if i == len(p.children)-1 {
+					return true
 				}
 			}
-			return outcomes[minIndex].matched, outcomes[minIndex].left, outcomes[minIndex].collected
+			m.rollback(mark)
 		}
-		return false, left, collected
-	} else if p.t&patternLeaf != 0 {
-		pos, match := p.singleMatch(left)
-		var increment interface{}
-		if match == nil {
-			return false, left, collected
-		}
-		leftAlt := make(patternList, len((*left)[:pos]), len((*left)[:pos])+len((*left)[pos+1:]))
-		copy(leftAlt, (*left)[:pos])
-		leftAlt = append(leftAlt, (*left)[pos+1:]...)
-		sameName := patternList{}
-		for _, a := range *collected {
-			if a.name == p.name {
-				sameName = append(sameName, a)
-			}
+		if best < 0 {
+			return false
 		}
-
-		switch p.value.(type) {
-		case int, []string:
-			switch p.value.(type) {
-			case int:
-				increment = 1
-			case []string:
-				switch match.value.(type) {
-				case string:
-					increment = []string{match.value.(string)}
-				default:
-					increment = match.value
-				}
-			}
-			if len(sameName) == 0 {
-				match.value = increment
-				collectedMatch := make(patternList, len(*collected), len(*collected)+1)
-				copy(collectedMatch, *collected)
-				collectedMatch = append(collectedMatch, match)
-				return true, &leftAlt, &collectedMatch
-			}
-			switch sameName[0].value.(type) {
-			case int:
-				sameName[0].value = sameName[0].value.(int) + increment.(int)
-			case []string:
-				sameName[0].value = append(sameName[0].value.([]string), increment.([]string)...)
-			}
-			return true, &leftAlt, collected
-		}
-		collectedMatch := make(patternList, len(*collected), len(*collected)+1)
-		copy(collectedMatch, *collected)
-		collectedMatch = append(collectedMatch, match)
-		return true, &leftAlt, &collectedMatch
+		return m.match(p.children[best])
+	} else if p.t&patternLeaf != 0 {
+		return m.matchLeaf(p)
 	}
 	panic("unmatched type")
 }
 
-func (p *pattern) singleMatch(left *patternList) (int, *pattern) {
+// sameCommand reports whether the argv value v spells the command name.
+func (m *matcher) sameCommand(v interface{}, name string) bool {
+	if v == name {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && m.fold != nil && m.fold(s) == m.fold(name)
+}
+
+func (m *matcher) matchLeaf(p *pattern) bool {
+	var match *pattern
 	if p.t&patternArgument != 0 {
-		for n, pat := range *left {
-			if pat.t&patternArgument != 0 {
-				return n, newArgument(p.name, pat.value)
-			}
+		i := m.next("", m.positional)
+		if i < 0 {
+			return false
 		}
-		return -1, nil
+		m.consume(i)
+		match = newArgument(p.name, m.argv[i].value)
 	} else if p.t&patternCommand != 0 {
-		for n, pat := range *left {
-			if pat.t&patternArgument != 0 {
-				if pat.value == p.name {
-					return n, newCommand(p.name, true)
-				}
-				break
-			}
+		i := m.next("", m.positional)
+		if i < 0 || !m.sameCommand(m.argv[i].value, p.name) && m.abbrev[i] != p.name {
+			return false
 		}
-		return -1, nil
+		m.consume(i)
+		match = newCommand(p.name, true)
 	} else if p.t&patternOption != 0 {
-		for n, pat := range *left {
-			if p.name == pat.name {
-				return n, pat
-			}
+		i := m.next(p.name, m.named[p.name])
+		if i < 0 {
+			return false
 		}
-		return -1, nil
+		m.consume(i)
+		match = m.argv[i]
+	} else {
+		panic("unmatched type")
 	}
-	panic("unmatched type")
+
+	var increment interface{}
+	switch p.value.(type) {
+	case int:
+		increment = 1
+		if match.value == false { // `--flag=false`
+			increment = 0
+		}
+	case []string:
+		switch match.value.(type) {
+		case string:
+			increment = []string{match.value.(string)}
+		default:
+			increment = match.value
+		}
+	default:
+		m.collect(match)
+		return true
+	}
+	if same, ok := m.sameName[p.name]; ok {
+		switch same.value.(type) {
+		case int:
+			m.setValue(same, same.value.(int)+increment.(int))
+		case []string:
+			m.setValue(same, append(same.value.([]string), increment.([]string)...))
+		}
+		return true
+	}
+	// copy, so that argv is never modified by accumulating values
+	counted := *match
+	counted.value = increment
+	m.collect(&counted)
+	return true
 }
 
 func (p *pattern) String() string {
@@ -1083,6 +1838,19 @@ func (p *pattern) String() string {
 	panic("unmatched type")
 }
 
+// tree writes p to b with one node per line, indented by depth.
+func (p *pattern) tree(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	if p.t&patternBranch == 0 {
+		b.WriteString(p.String() + "\n")
+		return
+	}
+	b.WriteString(p.t.String() + "\n")
+	for _, child := range p.children {
+		child.tree(b, depth+1)
+	}
+}
+
 func (p *pattern) transform() *pattern {
 	/*
 		Expand pattern into an (almost) equivalent one, but with single Either.
@@ -1154,25 +1922,6 @@ func (pl patternList) unique() patternList {
 	return result
 }
 
-func (pl patternList) index(p *pattern) (int, error) {
-	for i, c := range pl {
-		if c.eq(p) {
-			return i, nil
-		}
-	}
-	return -1, newError("%s not in list", p)
-}
-
-func (pl patternList) count(p *pattern) int {
-	count := 0
-	for _, c := range pl {
-		if c.eq(p) {
-			count++
-		}
-	}
-	return count
-}
-
 func (pl patternList) diff(l patternList) patternList {
 	lAlt := make(patternList, len(l))
 	copy(lAlt, l)
@@ -1225,15 +1974,17 @@ func stringPartition(s, sep string) (string, string, string) {
 }
 
 // returns true if all cased characters in the string are uppercase
-// and there are there is at least one cased charcter
+// and there is at least one cased character; characters from scripts
+// without case, and bytes that are not valid UTF-8, are ignored
 func isStringUppercase(s string) bool {
-	if strings.ToUpper(s) != s {
-		return false
-	}
-	for _, c := range []rune(s) {
+	upper := false
+	for _, c := range s {
+		if unicode.IsLower(c) || unicode.IsTitle(c) {
+			return false
+		}
 		if unicode.IsUpper(c) {
-			return true
+			upper = true
 		}
 	}
-	return false
+	return upper
 }
@@ -1201,7 +1201,59 @@ func TestIssue40(t *testing.T) {
 }
 
 func TestIssue34UnicodeStrings(t *testing.T) {
-	// TODO: see if applicable
+	doc := "Usage: prog [-é] <файл>\n\nOptions:\n  -é  Ünïcödé description."
+	if v, err := Parse(doc, []string{"-é", "ü"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"-é": true, "<файл>": "ü"}) != true {
+		t.Error(err)
+	}
+}
+
+func TestUnicodeShortOptions(t *testing.T) {
+	doc := "Usage: prog [-λé] [-ñ <n>]\n\nOptions:\n  -ñ <n>  Number."
+	if v, err := Parse(doc, []string{"-éλ", "-ñ5"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"-λ": true, "-é": true, "-ñ": "5"}) != true {
+		t.Error(err)
+	}
+	if v, err := Parse(doc, []string{"-ñλ"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"-λ": false, "-é": false, "-ñ": "λ"}) != true {
+		t.Error(err)
+	}
+	_, err := Parse(doc, []string{"-λx"}, true, "", false, false)
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+}
+
+func TestInvalidUTF8Argv(t *testing.T) {
+	raw := "file\xff\xfe.txt"
+	doc := "Usage: prog [-o <out>] <in>...\n\nOptions:\n  -o <out>  Output."
+	if v, err := Parse(doc, []string{raw, "-o" + raw, "\xff"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"-o": raw, "<in>": []string{raw, "\xff"}}) != true {
+		t.Error(err)
+	}
+	if v, err := Parse("Usage: prog [-a] [-\xff]", []string{"-\xffa"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"-a": true, "-\xff": true}) != true {
+		t.Error(err)
+	}
+}
+
+func TestIsStringUppercase(t *testing.T) {
+	for s, upper := range map[string]bool{
+		"FILE":     true,
+		"ÜBER":     true,
+		"ΑΒΓ":      true,
+		"FILE_名前":  true,
+		"NAME-2":   true,
+		"file":     false,
+		"Sß":       false,
+		"Ǆǅ":       false,
+		"名前":       false,
+		"ᲐᲑ":       true,
+		"\xffFILE": true,
+		"\xff":     false,
+	} {
+		if isStringUppercase(s) != upper {
+			t.Errorf("isStringUppercase(%q) != %v", s, upper)
+		}
+	}
+	if v, err := Parse("Usage: prog 名前 ИМЯ", []string{"名前", "x"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"名前": true, "ИМЯ": "x"}) != true {
+		t.Error(err)
+	}
 }
 
 func TestCountMultipleFlags(t *testing.T) {
@@ -1432,6 +1484,105 @@ func TestFileTestcases(t *testing.T) {
 	}
 }
 
+func TestMatchLongArgv(t *testing.T) {
+	argv := make([]string, 0, 1002)
+	want := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		argv = append(argv, fmt.Sprintf("file%d", i))
+		want = append(want, fmt.Sprintf("file%d", i))
+	}
+	argv = append(argv, "-v", "-v")
+	v, err := Parse("usage: prog [-v...] <file>...", argv, true, "", false, false)
+	w := map[string]interface{}{"-v": 2, "<file>": want}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(err)
+	}
+}
+
+func TestEitherMatchPicksFewestLeft(t *testing.T) {
+	v, w, x := newEither(
+		newOption("-a", "", 0, false),
+		newRequired(newOption("-a", "", 0, false),
+			newOption("-b", "", 0, false),
+			newOption("-c", "", 0, false)),
+		newRequired(newOption("-a", "", 0, false),
+			newOption("-b", "", 0, false))).match(&patternList{
+		newOption("-a", "", 0, false),
+		newOption("-b", "", 0, false),
+		newOption("-c", "", 0, false)}, nil)
+	z := patternList{newOption("-a", "", 0, false),
+		newOption("-b", "", 0, false),
+		newOption("-c", "", 0, false)}
+	if v != true ||
+		reflect.DeepEqual(*w, patternList{}) != true ||
+		reflect.DeepEqual(*x, z) != true {
+		t.Fail()
+	}
+}
+
+func TestLimits(t *testing.T) {
+	doc := "usage: prog " + strings.Repeat("(", 10000) + "a" + strings.Repeat(")", 10000)
+	_, err := Parse(doc, []string{"a"}, true, "", false, false)
+	if e, ok := err.(*LimitError); !ok || e.Limit != "Depth" {
+		t.Error(err)
+	}
+
+	doc = "usage: prog " + strings.Repeat("a | ", 100) + "b"
+	p := &Parser{Limits: Limits{Alternatives: 10}}
+	_, err = p.ParseArgs(doc, []string{"b"})
+	if e, ok := err.(*LimitError); !ok || e.Limit != "Alternatives" {
+		t.Error(err)
+	}
+
+	p = &Parser{Limits: Limits{DocSize: 10}}
+	_, err = p.ParseArgs("usage: prog [-v]", []string{})
+	if e, ok := err.(*LimitError); !ok || e.Limit != "DocSize" {
+		t.Error(err)
+	}
+
+	p = &Parser{Limits: Limits{Args: 2}}
+	_, err = p.ParseArgs("usage: prog <a>...", []string{"1", "2", "3"})
+	if e, ok := err.(*LimitError); !ok || e.Limit != "Args" {
+		t.Error(err)
+	}
+
+	p = &Parser{Limits: Limits{Steps: 10}}
+	_, err = p.ParseArgs("usage: prog <a>...", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"})
+	if e, ok := err.(*LimitError); !ok || e.Limit != "Steps" {
+		t.Error(err)
+	}
+
+	p = &Parser{Limits: Limits{Steps: -1, Args: -1}}
+	if v, err := p.ParseArgs("usage: prog <a>...", []string{"1", "2"}); reflect.DeepEqual(v, map[string]interface{}{"<a>": []string{"1", "2"}}) != true {
+		t.Error(err)
+	}
+}
+
+func TestManyAlternativesDoNotExpand(t *testing.T) {
+	// transform() would expand this to 2^40 cases
+	doc := "usage: prog" + strings.Repeat(" [a | b]", 40)
+	if v, err := Parse(doc, []string{"a", "b", "a"}, true, "", false, false); reflect.DeepEqual(v, map[string]interface{}{"a": 2, "b": 1}) != true {
+		t.Error(err)
+	}
+}
+
+func benchmarkPositionalArguments(b *testing.B, n int) {
+	argv := make([]string, n)
+	for i := range argv {
+		argv[i] = fmt.Sprintf("file%d", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse("usage: prog [-v] <file>...", argv, true, "", false, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPositionalArguments1k(b *testing.B)   { benchmarkPositionalArguments(b, 1000) }
+func BenchmarkPositionalArguments10k(b *testing.B)  { benchmarkPositionalArguments(b, 10000) }
+func BenchmarkPositionalArguments100k(b *testing.B) { benchmarkPositionalArguments(b, 100000) }
+
 type testcase struct {
 	id        int
 	doc       string
@@ -1534,3 +1685,48 @@ func debug(l ...interface{}) {
 		fmt.Println(l...)
 	}
 }
+
+func TestCheck(t *testing.T) {
+	p := &Parser{}
+	if err := p.Check(navalFate); err != nil {
+		t.Error(err)
+	}
+	if err := p.Check("Usage: prog [<input>]\n\nOptions:\n  --in=<f>  [type: infile] [default: missing.txt]"); err != nil {
+		t.Error(err)
+	}
+	if err := p.Check("Usage: prog (<a>"); err == nil {
+		t.Error("expected an error for unmatched (")
+	} else if e, ok := err.(*LanguageError); !ok || e.Line != 1 || e.Column != 13 {
+		t.Error(err)
+	}
+	if err := p.Check("Usage: prog <a>\n  prog --all\n\nOptions:\n  -v  Louder [counter: bogus base=x]"); err == nil {
+		t.Error("expected an error for a bad counter")
+	} else if e, ok := err.(*LanguageError); !ok || e.Line != 5 || e.Column != 14 {
+		t.Error(err, e.Line, e.Column)
+	}
+	if err := p.Check("prog <a>"); err == nil {
+		t.Error("expected an error for a missing usage section")
+	} else if e, ok := err.(*LanguageError); !ok || e.Line != 0 {
+		t.Error(err)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	o := parseDefaults("Options:\n  -a  All.\n  -b  Brief.\n  -f <file>  File.")
+	for source, expect := range map[string]string{
+		"((-a))":                  "required(option(-a, , 0, false))",
+		"[[-a] -b]":               "required(optional(option(-a, , 0, false), option(-b, , 0, false)))",
+		"[options]":               "required(optionsshortcut())",
+		"(-a | (-b | -f <file>))": "required(either(option(-a, , 0, false), option(-b, , 0, false), option(-f, , 1, <nil>)))",
+		"(N [M]) | (N)":           "required(either(required(argument(N, <nil>), optional(argument(M, <nil>))), argument(N, <nil>)))",
+		"(<x>...)":                "required(oneormore(argument(<x>, <nil>)))",
+	} {
+		pat, err := parsePattern(source, &o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := pat.simplified().String(); s != expect {
+			t.Errorf("%s: %s", source, s)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package docopt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorFormat renders a UserError in the usual command line style:
+//
+//	prog: error: unknown option --sped
+//	Usage:
+//	  prog ship <name> move <x> <y> [--speed=<kn>]
+//	Try 'prog --help' for more information.
+type ErrorFormat struct {
+	// Color highlights the error with ANSI escape codes.
+	Color bool
+	// RelevantUsage shows only the usage lines that start with the same
+	// commands as argv, instead of the whole usage section.
+	RelevantUsage bool
+}
+
+// Render returns the text shown to the user for e.
+func (f ErrorFormat) Render(e *UserError) string {
+	msg := e.Error()
+	if msg == "" {
+		msg = "invalid arguments"
+	}
+	label := "error:"
+	if f.Color {
+		label = "\x1b[1;31m" + label + "\x1b[0m"
+	}
+	lines := []string{}
+	if e.Prog != "" {
+		lines = append(lines, fmt.Sprintf("%s: %s %s", e.Prog, label, msg))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s %s", label, msg))
+	}
+	usage := strings.TrimSpace(e.Usage)
+	if f.RelevantUsage && len(e.UsageLines) > 0 {
+		usage = "Usage:\n  " + strings.Join(e.UsageLines, "\n  ")
+	}
+	if usage != "" {
+		lines = append(lines, usage)
+	}
+	if e.Prog != "" && e.HelpFlag != "" {
+		lines = append(lines, fmt.Sprintf("Try '%s %s' for more information.", e.Prog, e.HelpFlag))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// relevantUsage returns the program name from the usage section, and the
+// usage lines whose leading commands match most of the positional arguments
+// in argv; all lines if none match. Options are told apart with syntax.
+func relevantUsage(usage string, argv []string, syntax OptionSyntax) (string, []string) {
+	_, _, section := stringPartition(usage, ":")
+	lines := []string{}
+	for _, line := range strings.Split(section, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	prog := strings.Fields(lines[0])[0]
+
+	positional := []string{}
+	for _, arg := range argv {
+		if arg == "--" {
+			break
+		}
+		if !syntax.isOption(arg) && !syntax.isStrayLong(arg) {
+			positional = append(positional, arg)
+		}
+	}
+	best, relevant := 0, []string{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if fields[0] != prog {
+			continue
+		}
+		n := 0
+		for _, word := range fields[1:] {
+			if !isCommandWord(word, syntax) || n >= len(positional) || positional[n] != word {
+				break
+			}
+			n++
+		}
+		if n > best {
+			best, relevant = n, nil
+		}
+		if n == best && n > 0 {
+			relevant = append(relevant, line)
+		}
+	}
+	if best == 0 {
+		relevant = []string{}
+		for _, line := range lines {
+			if strings.HasPrefix(line, prog) {
+				relevant = append(relevant, line)
+			}
+		}
+	}
+	return prog, relevant
+}
+
+// isCommandWord reports whether word in a usage pattern is a command.
+func isCommandWord(word string, syntax OptionSyntax) bool {
+	if word == "" || strings.ContainsAny(word[:1], "-<[(|.") || syntax.isOption(word) {
+		return false
+	}
+	return !isStringUppercase(word)
+}
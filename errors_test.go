@@ -0,0 +1,72 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserErrorDetails(t *testing.T) {
+	p := &Parser{Help: true}
+	_, output, err := p.parse(navalFate, []string{"ship", "Guardian", "move", "1", "2", "--sped=3"})
+	e, ok := err.(*UserError)
+	if !ok {
+		t.Fatal(err)
+	}
+	if e.Error() != "unknown option --sped" || e.Prog != "naval_fate" || e.HelpFlag != "--help" {
+		t.Errorf("%q %q %q", e.Error(), e.Prog, e.HelpFlag)
+	}
+	if e.Usage != parseSection("usage:", navalFate)[0] {
+		t.Errorf("%q", e.Usage)
+	}
+	lines := []string{
+		"naval_fate ship new <name>...",
+		"naval_fate ship <name> move <x> <y> [--speed=<kn>]",
+		"naval_fate ship shoot <x> <y>",
+	}
+	if !reflect.DeepEqual(e.UsageLines, lines) {
+		t.Errorf("%q", e.UsageLines)
+	}
+	expect := "naval_fate: error: unknown option --sped\n" + e.Usage + "\nTry 'naval_fate --help' for more information."
+	if output != expect {
+		t.Errorf("%q", output)
+	}
+
+	_, _, err = (&Parser{}).parse(navalFate, []string{"mine", "set"})
+	e = err.(*UserError)
+	if e.HelpFlag != "" || !reflect.DeepEqual(e.UsageLines, []string{"naval_fate mine (set|remove) <x> <y> [--moored|--drifting]"}) {
+		t.Errorf("%q %q", e.HelpFlag, e.UsageLines)
+	}
+
+	_, _, err = (&Parser{}).parse(navalFate, []string{"torpedo"})
+	if e := err.(*UserError); len(e.UsageLines) != 6 {
+		t.Errorf("%q", e.UsageLines)
+	}
+
+	p = &Parser{Syntax: OptionSyntax{Long: "/", Short: "/"}}
+	_, _, err = p.parse("Usage:\n  prog go [/speed=<kn>]\n  prog stop", []string{"/speed=3", "go", "now"})
+	if e := err.(*UserError); !reflect.DeepEqual(e.UsageLines, []string{"prog go [/speed=<kn>]"}) {
+		t.Errorf("%q", e.UsageLines)
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	e := &UserError{
+		msg:        "unknown option --sped",
+		Usage:      "Usage: prog go [--speed=<kn>]\n       prog stop",
+		Prog:       "prog",
+		UsageLines: []string{"prog go [--speed=<kn>]"},
+		HelpFlag:   "-h",
+	}
+	if s := (ErrorFormat{RelevantUsage: true}).Render(e); s != "prog: error: unknown option --sped\nUsage:\n  prog go [--speed=<kn>]\nTry 'prog -h' for more information." {
+		t.Errorf("%q", s)
+	}
+	e.msg, e.HelpFlag = "", ""
+	if s := (ErrorFormat{Color: true}).Render(e); s != "prog: \x1b[1;31merror:\x1b[0m invalid arguments\n"+e.Usage {
+		t.Errorf("%q", s)
+	}
+
+	p := &Parser{RenderError: func(e *UserError) string { return e.Prog + " says no" }}
+	if _, output, _ := p.parse("Usage: prog go", []string{"stop"}); output != "prog says no" {
+		t.Errorf("%q", output)
+	}
+}
@@ -2,7 +2,10 @@ package docopt
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sort"
+	"testing/fstest"
 )
 
 func ExampleParse() {
@@ -35,3 +38,29 @@ func ExampleParse() {
 	//    serial false
 	//       tcp true
 }
+
+func ExampleOpts_Close() {
+	usage := `Usage: cat [-o <out>] <in>...
+
+Arguments:
+  <in>  Files to read [type: infile].
+
+Options:
+  -o <out>  Output file [type: outfile] [default: -].`
+	parser := &Parser{
+		FS:     ReadOnlyFS(fstest.MapFS{"a.txt": {Data: []byte("hello\n")}}),
+		Stdout: os.Stdout,
+	}
+	args, err := parser.ParseArgs(usage, []string{"a.txt"})
+	if err != nil {
+		return
+	}
+	// close the files that were opened, once done with them
+	defer Opts(args).Close()
+	out := args["-o"].(io.Writer)
+	for _, in := range args["<in>"].([]io.ReadCloser) {
+		io.Copy(out, in)
+	}
+	// output:
+	// hello
+}
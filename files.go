@@ -0,0 +1,359 @@
+package docopt
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileSystem opens the files named by `[type: infile]` and `[type: outfile]`
+// options and arguments. Access checks that name can be opened, or created
+// if write is set, without doing so; its errors are those Open and Create
+// would return.
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	Access(name string, write bool) error
+}
+
+// OSFileSystem is the FileSystem of the operating system.
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+// errIsDir is the error of a directory given as a file.
+var errIsDir = errors.New("is a directory")
+
+func (osFileSystem) Access(name string, write bool) error {
+	if !write {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		// it is created in its directory
+		fi, err = os.Stat(filepath.Dir(name))
+		if err == nil && !fi.IsDir() {
+			return &fs.PathError{Op: "create", Path: name, Err: fs.ErrNotExist}
+		}
+	} else if err == nil && fi.IsDir() {
+		return &fs.PathError{Op: "create", Path: name, Err: errIsDir}
+	}
+	if err == nil && fi.Mode().Perm()&0222 == 0 {
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrPermission}
+	}
+	return err
+}
+
+// ReadOnlyFS returns a FileSystem that opens files from fsys, such as an
+// embed.FS or a testing/fstest.MapFS, and can not create any.
+func ReadOnlyFS(fsys fs.FS) FileSystem {
+	return readOnlyFS{fsys}
+}
+
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+func (r readOnlyFS) Open(name string) (io.ReadCloser, error) {
+	return r.fsys.Open(name)
+}
+
+func (r readOnlyFS) Create(name string) (io.WriteCloser, error) {
+	return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrPermission}
+}
+
+func (r readOnlyFS) Access(name string, write bool) error {
+	if write {
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrPermission}
+	}
+	_, err := fs.Stat(r.fsys, name)
+	return err
+}
+
+// Close closes the files of the options and arguments in o that were opened.
+// Files given as `-` are left open.
+func (o Opts) Close() error {
+	var first error
+	for _, v := range o {
+		for _, c := range closers(v) {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func closers(v interface{}) []io.Closer {
+	switch v := v.(type) {
+	case io.Closer:
+		return []io.Closer{v}
+	case []io.ReadCloser:
+		result := make([]io.Closer, len(v))
+		for i, c := range v {
+			result[i] = c
+		}
+		return result
+	case []io.WriteCloser:
+		result := make([]io.Closer, len(v))
+		for i, c := range v {
+			result[i] = c
+		}
+		return result
+	}
+	return nil
+}
+
+// reType matches a `[type: ...]` annotation in a description.
+var reType = regexp.MustCompile(`(?i)\[type: *(\S*?)\]`)
+
+// parseTypes returns the `[type: ...]` annotations of the options in the
+// "options:" sections and of the arguments in the "arguments:" sections of
+// doc, by name.
+func parseTypes(doc string, syntax OptionSyntax) (map[string]string, error) {
+	types := make(map[string]string)
+	add := func(name, annotation string, offset int) error {
+		matched := reType.FindStringSubmatchIndex(annotation)
+		if matched == nil {
+			return nil
+		}
+		typ := strings.ToLower(annotation[matched[2]:matched[3]])
+		if typ != "infile" && typ != "outfile" {
+			return errorAt(newLanguageError("unknown type for %s: %s", name, typ), offset+matched[0])
+		}
+		types[name] = typ
+		return nil
+	}
+	descriptions, at := syntax.optionDescriptionsAt(doc)
+	for i, description := range descriptions {
+		names, _, _ := stringPartition(description, "  ")
+		offset := len(names)
+		if err := add(syntax.parseOption(description).name, description[offset:], at[i]+offset); err != nil {
+			return nil, err
+		}
+	}
+	sections, at := sectionsAt("arguments:", doc)
+	for i, s := range sections {
+		title, _, s := stringPartition(s, ":") // get rid of "arguments:"
+		offset := at[i] + len(title) + 1
+		for _, line := range strings.Split(s, "\n") {
+			fields := strings.Fields(line)
+			name := ""
+			if len(fields) > 0 {
+				name = fields[0]
+			}
+			if strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">") || name != "" && isStringUppercase(name) {
+				if err := add(name, line, offset); err != nil {
+					return nil, err
+				}
+			}
+			offset += len(line) + 1
+		}
+	}
+	return types, nil
+}
+
+// checkFiles checks that the typed files in args can be opened, for errors
+// in argv before they are.
+func (p *Parser) checkFiles(args map[string]interface{}, types map[string]string) error {
+	for name, typ := range types {
+		var names []string
+		switch v := args[name].(type) {
+		case string:
+			names = []string{v}
+		case []string:
+			names = v
+		}
+		for _, s := range names {
+			if s == "-" {
+				continue
+			}
+			if err := p.fs().Access(s, typ == "outfile"); err != nil {
+				return fileError(s, err)
+			}
+		}
+	}
+	return nil
+}
+
+// openFiles replaces the names in args of typed files with files that are
+// opened on their first Read or Write.
+func (p *Parser) openFiles(args map[string]interface{}, types map[string]string) {
+	for name, typ := range types {
+		switch v := args[name].(type) {
+		case string:
+			if typ == "infile" {
+				args[name] = p.lazyIn(v)
+			} else {
+				args[name] = p.lazyOut(v)
+			}
+		case []string:
+			if typ == "infile" {
+				files := []io.ReadCloser{}
+				for _, s := range v {
+					files = append(files, p.lazyIn(s))
+				}
+				args[name] = files
+			} else {
+				files := []io.WriteCloser{}
+				for _, s := range v {
+					files = append(files, p.lazyOut(s))
+				}
+				args[name] = files
+			}
+		}
+	}
+}
+
+// lazyFile is a file of an option or argument. It is opened on its first
+// Read or Write, so that files that are never used are not created or
+// truncated, and it is only closed if it was opened.
+type lazyFile struct {
+	name string
+	open func(name string) (io.Closer, error)
+	file io.Closer
+	err  error
+}
+
+// Name returns the name of the file, as argv gave it.
+func (f *lazyFile) Name() string {
+	return f.name
+}
+
+func (f *lazyFile) opened() (io.Closer, error) {
+	if f.file == nil && f.err == nil {
+		f.file, f.err = f.open(f.name)
+	}
+	return f.file, f.err
+}
+
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file, f.err = nil, fs.ErrClosed
+	return err
+}
+
+type lazyReader struct {
+	*lazyFile
+}
+
+func (r lazyReader) Read(b []byte) (int, error) {
+	file, err := r.opened()
+	if err != nil {
+		return 0, err
+	}
+	return file.(io.Reader).Read(b)
+}
+
+type lazyWriter struct {
+	*lazyFile
+}
+
+func (w lazyWriter) Write(b []byte) (int, error) {
+	file, err := w.opened()
+	if err != nil {
+		return 0, err
+	}
+	return file.(io.Writer).Write(b)
+}
+
+func (p *Parser) lazyIn(name string) io.ReadCloser {
+	return lazyReader{&lazyFile{name: name, open: func(name string) (io.Closer, error) {
+		return p.openIn(name)
+	}}}
+}
+
+func (p *Parser) lazyOut(name string) io.WriteCloser {
+	return lazyWriter{&lazyFile{name: name, open: func(name string) (io.Closer, error) {
+		return p.openOut(name)
+	}}}
+}
+
+func (p *Parser) fs() FileSystem {
+	if p.FS != nil {
+		return p.FS
+	}
+	return OSFileSystem
+}
+
+func (p *Parser) stdout() io.Writer {
+	if p.Stdout != nil {
+		return p.Stdout
+	}
+	return os.Stdout
+}
+
+func (p *Parser) stderr() io.Writer {
+	if p.Stderr != nil {
+		return p.Stderr
+	}
+	return os.Stderr
+}
+
+func (p *Parser) openIn(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		if p.Stdin != nil {
+			return io.NopCloser(p.Stdin), nil
+		}
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := p.fs().Open(name)
+	if err != nil {
+		return nil, fileError(name, err)
+	}
+	return f, nil
+}
+
+func (p *Parser) openOut(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopWriteCloser{p.stdout()}, nil
+	}
+	f, err := p.fs().Create(name)
+	if err != nil {
+		return nil, fileError(name, err)
+	}
+	return f, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func fileError(name string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return newUserError("%s: no such file", name)
+	case errors.Is(err, fs.ErrPermission):
+		return newUserError("%s: permission denied", name)
+	case errors.Is(err, fs.ErrInvalid):
+		return newUserError("%s: invalid file name", name)
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return newUserError("%s: %s", name, err)
+}
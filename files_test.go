@@ -0,0 +1,180 @@
+package docopt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const catDoc = `Usage: cat [-o <out>] [<in>...]
+
+Arguments:
+  <in>  Files to read [type: infile].
+
+Options:
+  -o <out>  Output file [type: outfile] [default: -].`
+
+type memFS struct {
+	files   map[string]string
+	created map[string]*memFile
+	closed  int
+}
+
+type memFile struct {
+	bytes.Buffer
+	fs *memFS
+}
+
+func (f *memFile) Close() error {
+	f.fs.closed++
+	return nil
+}
+
+func (m *memFS) Open(name string) (io.ReadCloser, error) {
+	if name == "secret" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	content, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f := &memFile{fs: m}
+	f.WriteString(content)
+	return f, nil
+}
+
+func (m *memFS) Create(name string) (io.WriteCloser, error) {
+	f := &memFile{fs: m}
+	m.created[name] = f
+	return f, nil
+}
+
+func (m *memFS) Access(name string, write bool) error {
+	if _, ok := m.files[name]; name == "secret" || write && ok {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	} else if !ok && !write {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func TestFileArguments(t *testing.T) {
+	m := &memFS{files: map[string]string{"a": "A", "b": "B"}, created: map[string]*memFile{}}
+	var stdout bytes.Buffer
+	p := &Parser{FS: m, Stdin: strings.NewReader("STDIN"), Stdout: &stdout}
+	args, err := p.ParseArgs(catDoc, []string{"a", "-", "b", "-o", "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, ok := args["<in>"].([]io.ReadCloser)
+	if !ok || len(files) != 3 {
+		t.Fatal(args)
+	}
+	out := args["-o"].(io.WriteCloser)
+	for _, f := range files {
+		io.Copy(out, f)
+	}
+	if err := Opts(args).Close(); err != nil {
+		t.Error(err)
+	}
+	if m.created["out"].String() != "ASTDINB" || m.closed != 3 {
+		t.Error(m.created["out"].String(), m.closed)
+	}
+
+	// `-` is the default for -o, and stdout is not closed
+	args, err = p.ParseArgs(catDoc, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(args["-o"].(io.Writer), "hello")
+	Opts(args).Close()
+	if stdout.String() != "hello" || len(args["<in>"].([]io.ReadCloser)) != 0 {
+		t.Error(stdout.String(), args)
+	}
+}
+
+func TestFileArgumentErrors(t *testing.T) {
+	m := &memFS{files: map[string]string{"a": "A"}, created: map[string]*memFile{}}
+	for _, tc := range []struct {
+		argv []string
+		err  string
+	}{
+		{[]string{"a", "missing"}, "missing: no such file"},
+		{[]string{"secret"}, "secret: permission denied"},
+		{[]string{"-o", "a"}, "a: permission denied"}, // files of m can not be written
+	} {
+		var stderr bytes.Buffer
+		args, err := (&Parser{FS: m, Stderr: &stderr}).ParseArgs(catDoc, tc.argv)
+		if _, ok := err.(*UserError); !ok || err.Error() != tc.err || args != nil {
+			t.Errorf("%v: %v %v", tc.argv, args, err)
+		}
+		if !strings.HasPrefix(stderr.String(), "cat: error: "+tc.err+"\nUsage:") {
+			t.Errorf("%v: %q", tc.argv, stderr.String())
+		}
+	}
+
+	// files are checked, but only opened when read or written
+	args, err := (&Parser{FS: m}).ParseArgs(catDoc, []string{"a", "-o", "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.created) != 0 {
+		t.Error("out was created")
+	}
+	Opts(args).Close()
+	if m.closed != 0 {
+		t.Error("files closed that were not opened:", m.closed)
+	}
+	_, err = (&Parser{FS: m}).ParseArgs("Usage: prog <x>\n\nArguments:\n  <x>  Thing [type: socket].", []string{"x"})
+	if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+}
+
+func TestOSFileSystemAccess(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.txt")
+	os.WriteFile(in, []byte("data"), 0o444)
+	for _, tc := range []struct {
+		name  string
+		write bool
+		err   error
+	}{
+		{in, false, nil},
+		{filepath.Join(dir, "missing"), false, fs.ErrNotExist},
+		{filepath.Join(dir, "new.txt"), true, nil},
+		{filepath.Join(dir, "no", "new.txt"), true, fs.ErrNotExist},
+		{dir, true, errIsDir},
+	} {
+		if err := OSFileSystem.Access(tc.name, tc.write); !errors.Is(err, tc.err) {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+	if os.Getuid() != 0 {
+		if err := OSFileSystem.Access(in, true); !errors.Is(err, fs.ErrPermission) {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReadOnlyFS(t *testing.T) {
+	p := &Parser{FS: ReadOnlyFS(fstest.MapFS{"in.txt": {Data: []byte("data")}}), Stderr: io.Discard}
+	if _, err := p.ParseArgs(catDoc, []string{"in.txt", "-o", "out.txt"}); err == nil || err.Error() != "out.txt: permission denied" {
+		t.Error(err)
+	}
+	args, err := p.ParseArgs(catDoc, []string{"in.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Opts(args).Close()
+	data, _ := io.ReadAll(args["<in>"].([]io.ReadCloser)[0])
+	if string(data) != "data" {
+		t.Error(string(data))
+	}
+}
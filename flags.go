@@ -0,0 +1,45 @@
+package docopt
+
+import "strings"
+
+// DefaultTruthy and DefaultFalsy are the explicit values of flags when
+// Parser.FlagValues is set and Truthy or Falsy are nil.
+var (
+	DefaultTruthy = []string{"true", "yes", "on", "1"}
+	DefaultFalsy  = []string{"false", "no", "off", "0"}
+)
+
+// flagWords returns the values flags accept in argv, or nil if they accept
+// none.
+func (p *Parser) flagWords() (truthy, falsy []string) {
+	if !p.FlagValues {
+		return nil, nil
+	}
+	truthy, falsy = p.Truthy, p.Falsy
+	if truthy == nil {
+		truthy = DefaultTruthy
+	}
+	if falsy == nil {
+		falsy = DefaultFalsy
+	}
+	return truthy, falsy
+}
+
+// flagValue returns the value of flag given as `flag=value` in argv.
+func (tokens *tokenList) flagValue(flag, value string) (bool, error) {
+	if tokens.truthy == nil {
+		return false, tokens.errorFunc("%s must not have an argument", flag)
+	}
+	for _, word := range tokens.truthy {
+		if strings.EqualFold(value, word) {
+			return true, nil
+		}
+	}
+	for _, word := range tokens.falsy {
+		if strings.EqualFold(value, word) {
+			return false, nil
+		}
+	}
+	words := append(append([]string{}, tokens.truthy...), tokens.falsy...)
+	return false, tokens.errorFunc("%s does not take %q, only one of %s", flag, value, strings.Join(words, ", "))
+}
@@ -0,0 +1,59 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+const flagsDoc = `Usage: prog [-v...] [--force] [--verbose] [<file>]
+
+Options:
+  -v          Louder.
+  --force     Overwrite.
+  --verbose   Explain.`
+
+func TestFlagValues(t *testing.T) {
+	p := &Parser{FlagValues: true}
+	for _, tc := range []struct {
+		argv   []string
+		expect map[string]interface{}
+	}{
+		{[]string{"--verbose=false", "--force=YES"}, map[string]interface{}{"-v": 0, "--force": true, "--verbose": false, "<file>": nil}},
+		{[]string{"--verbose=on", "--force=0"}, map[string]interface{}{"-v": 0, "--force": false, "--verbose": true, "<file>": nil}},
+		{[]string{"--verb=1"}, map[string]interface{}{"-v": 0, "--force": false, "--verbose": true, "<file>": nil}},
+		// a separate word is an argument, not the value of the flag
+		{[]string{"--force", "no"}, map[string]interface{}{"-v": 0, "--force": true, "--verbose": false, "<file>": "no"}},
+	} {
+		v, err := p.ParseArgs(flagsDoc, tc.argv)
+		if err != nil || !reflect.DeepEqual(v, tc.expect) {
+			t.Errorf("%v: %v %v", tc.argv, v, err)
+		}
+	}
+
+	_, _, err := p.parse(flagsDoc, []string{"--force=maybe"})
+	if _, ok := err.(*UserError); !ok || err.Error() != `--force does not take "maybe", only one of true, yes, on, 1, false, no, off, 0` {
+		t.Error(err)
+	}
+
+	v, err := p.ParseArgs("Usage: prog [--loud...]", []string{"--loud", "--loud=false", "--loud=true"})
+	if err != nil || v["--loud"] != 2 {
+		t.Error(v, err)
+	}
+
+	// off by default
+	_, _, err = (&Parser{}).parse(flagsDoc, []string{"--force=yes"})
+	if _, ok := err.(*UserError); !ok || err.Error() != "--force must not have an argument" {
+		t.Error(err)
+	}
+}
+
+func TestFlagValuesVocabulary(t *testing.T) {
+	p := &Parser{FlagValues: true, Truthy: []string{"ja"}, Falsy: []string{"nein"}}
+	v, err := p.ParseArgs(flagsDoc, []string{"--force=ja", "--verbose=Nein"})
+	if err != nil || v["--force"] != true || v["--verbose"] != false {
+		t.Error(v, err)
+	}
+	if _, _, err = p.parse(flagsDoc, []string{"--force=yes"}); err == nil {
+		t.Error("yes is not in the vocabulary")
+	}
+}
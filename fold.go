@@ -0,0 +1,71 @@
+package docopt
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fold returns the function used to compare commands (and long options if
+// FoldLongOptions is set), or nil if they are compared exactly.
+func (p *Parser) fold() func(string) string {
+	if !p.CaseInsensitive && p.Normalize == nil {
+		return nil
+	}
+	return func(s string) string {
+		if p.Normalize != nil {
+			s = p.Normalize(s)
+		}
+		if p.CaseInsensitive {
+			s = foldCase(s)
+		}
+		return s
+	}
+}
+
+// foldCase maps every rune of s to the smallest rune of its case folding
+// orbit, so that two strings fold to the same value exactly when they are
+// equal under simple Unicode case folding (as strings.EqualFold).
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, s)
+}
+
+// FoldWidth maps full-width forms of ASCII characters, as typed with many
+// East Asian input methods, and the ideographic space to their ASCII
+// equivalents. It is the subset of NFKC normalization that matters for
+// command lines, for use as Parser.Normalize without external packages.
+func FoldWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '！' && r <= '～':
+			return r - '！' + '!'
+		case r == '　':
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// checkFolded returns a LanguageError if two distinct names are the same
+// after folding, as they could not be told apart in argv.
+func checkFolded(kind string, names []string, fold func(string) string) error {
+	seen := make(map[string]string)
+	for _, name := range names {
+		key := fold(name)
+		if other, ok := seen[key]; ok && other != name {
+			pair := []string{other, name}
+			sort.Strings(pair)
+			return newLanguageError("%s %s and %s are ambiguous when folded", kind, pair[0], pair[1])
+		}
+		seen[key] = name
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCaseInsensitiveCommands(t *testing.T) {
+	doc := `Usage:
+  naval_fate ship new <name>...
+  naval_fate ship <name> move <x> <y> [--speed=<kn>]
+
+Options:
+  --speed=<kn>  Speed in knots [default: 10].`
+	p := &Parser{CaseInsensitive: true}
+	v, err := p.ParseArgs(doc, []string{"Ship", "NEW", "Guardian"})
+	w := map[string]interface{}{"ship": true, "new": true, "move": false,
+		"<name>": []string{"Guardian"}, "<x>": nil, "<y>": nil, "--speed": "10"}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(err)
+	}
+
+	// long options are only folded on request
+	_, err = p.ParseArgs(doc, []string{"ship", "x", "move", "1", "2", "--SPEED=3"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+	p.FoldLongOptions = true
+	v, err = p.ParseArgs(doc, []string{"ship", "x", "move", "1", "2", "--SPEED=Fast"})
+	if v["--speed"] != "Fast" {
+		t.Error(v, err)
+	}
+	v, err = p.ParseArgs(doc, []string{"ship", "x", "move", "1", "2", "--SPE=3"})
+	if v["--speed"] != "3" {
+		t.Error(v, err)
+	}
+
+	_, err = (&Parser{}).ParseArgs(doc, []string{"Ship", "new", "Guardian"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+}
+
+func TestNormalizedCommands(t *testing.T) {
+	p := &Parser{Normalize: FoldWidth}
+	v, err := p.ParseArgs("Usage: prog ship new", []string{"ｓｈｉｐ", "new"})
+	if reflect.DeepEqual(v, map[string]interface{}{"ship": true, "new": true}) != true {
+		t.Error(err)
+	}
+	_, err = p.ParseArgs("Usage: prog ship new", []string{"ＳＨＩＰ", "new"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+	p.CaseInsensitive = true
+	v, err = p.ParseArgs("Usage: prog ship new", []string{"ＳＨＩＰ", "new"})
+	if reflect.DeepEqual(v, map[string]interface{}{"ship": true, "new": true}) != true {
+		t.Error(err)
+	}
+}
+
+func TestFoldedAmbiguities(t *testing.T) {
+	p := &Parser{CaseInsensitive: true}
+	_, err := p.ParseArgs("Usage: prog (add | Add)", []string{"add"})
+	if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+	_, err = p.ParseArgs("Usage: prog [--all | --ALL]", []string{})
+	if err != nil {
+		t.Error(err)
+	}
+	p.FoldLongOptions = true
+	_, err = p.ParseArgs("Usage: prog [--all | --ALL]", []string{})
+	if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+	p = &Parser{Normalize: FoldWidth}
+	_, err = p.ParseArgs("Usage: prog (add | ａｄｄ)", []string{"add"})
+	if _, ok := err.(*LanguageError); !ok {
+		t.Error(err)
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		same bool
+	}{
+		{"ship", "SHIP", true},
+		{"ΣΊΣΥΦΟΣ", "σίσυφος", true},
+		{"K", "K", true}, // Kelvin sign
+		{"Straße", "STRASSE", false},
+		{"ship", "shop", false},
+	} {
+		if same := foldCase(c.a) == foldCase(c.b); same != c.same {
+			t.Errorf("foldCase(%q) == foldCase(%q) is %v", c.a, c.b, same)
+		}
+	}
+}
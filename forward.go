@@ -0,0 +1,216 @@
+package docopt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Invocation is what Forward sends to a Server: the arguments, working
+// directory and selected environment of the client.
+type Invocation struct {
+	Argv []string
+	Dir  string
+	Env  map[string]string
+}
+
+// frame is a message from the server to the client: output on stream 1
+// (stdout) or 2 (stderr), or the exit code.
+type frame struct {
+	Stream int    `json:",omitempty"`
+	Data   []byte `json:",omitempty"`
+	Exit   *int   `json:",omitempty"`
+}
+
+// Forward runs argv on the Server listening on the Unix socket, with the
+// working directory and the environment variables named in env. It copies
+// the output of the server to stdout and stderr as it comes, and returns the
+// exit code. If argv is nil, os.Args[1:] is used.
+func Forward(socket string, argv []string, env []string, stdout, stderr io.Writer) (int, error) {
+	if argv == nil {
+		argv = os.Args[1:]
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+	inv := Invocation{Argv: argv, Dir: dir, Env: map[string]string{}}
+	for _, name := range env {
+		if value, ok := os.LookupEnv(name); ok {
+			inv.Env[name] = value
+		}
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(inv); err != nil {
+		return 0, err
+	}
+	dec := json.NewDecoder(conn)
+	for {
+		var f frame
+		if err := dec.Decode(&f); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		switch {
+		case f.Exit != nil:
+			return *f.Exit, nil
+		case f.Stream == 1:
+			stdout.Write(f.Data)
+		case f.Stream == 2:
+			stderr.Write(f.Data)
+		}
+	}
+}
+
+// Server parses the invocations forwarded to it against Doc, and runs
+// Handler on them. Help, version and errors in argv are printed to the
+// client like ParseArgs prints them, with exit code 0 or 2; errors in Doc
+// are printed with exit code 1. A Handler that panics fails only its call:
+// the panic is printed to the client with exit code 1.
+type Server struct {
+	Doc string
+	// Parser holds the settings of parsing. Its FS opens files relative to
+	// the directory of the client, and its Exit, Stdin, Stdout and Stderr
+	// are ignored.
+	Parser  Parser
+	Handler func(c *Call)
+}
+
+// Call is an invocation being run by a Server.
+type Call struct {
+	Args Opts
+	Dir  string
+	Env  map[string]string
+	// Stdout and Stderr stream to the client.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	code int
+}
+
+// Exit sets the exit code of the client, 0 unless called.
+func (c *Call) Exit(code int) {
+	c.code = code
+}
+
+// Serve runs the invocations of the connections of l until it fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn runs the invocation of a connection and closes it.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	var inv Invocation
+	if err := json.NewDecoder(conn).Decode(&inv); err != nil {
+		return
+	}
+	out := &frameWriter{enc: json.NewEncoder(conn)}
+	stdout, stderr := &streamWriter{out, 1}, &streamWriter{out, 2}
+	code := s.run(inv, stdout, stderr)
+	out.write(frame{Exit: &code})
+}
+
+func (s *Server) run(inv Invocation, stdout, stderr io.Writer) (code int) {
+	p := s.Parser
+	p.Exit = false
+	p.Stdin = strings.NewReader("")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	p.NoPager = true
+	p.FS = dirFS{p.fs(), inv.Dir}
+	argv := inv.Argv
+	if argv == nil {
+		argv = []string{}
+	}
+	args, err := p.ParseArgs(s.Doc, argv)
+	switch err.(type) {
+	case nil:
+	case *UserError:
+		return 2
+	default:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if args == nil { // help or version
+		return 0
+	}
+	defer Opts(args).Close()
+	c := &Call{Args: args, Dir: inv.Dir, Env: inv.Env, Stdout: stdout, Stderr: stderr}
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "panic: %v\n", r)
+			code = 1
+		}
+	}()
+	s.Handler(c)
+	return c.code
+}
+
+// frameWriter sends frames, from any goroutine of a handler.
+type frameWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *frameWriter) write(f frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(f)
+}
+
+// streamWriter writes to a stream of the client.
+type streamWriter struct {
+	w      *frameWriter
+	stream int
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	data := append([]byte{}, b...)
+	if err := w.w.write(frame{Stream: w.stream, Data: data}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// dirFS opens relative names in dir.
+type dirFS struct {
+	fs  FileSystem
+	dir string
+}
+
+func (d dirFS) path(name string) string {
+	if filepath.IsAbs(name) || d.dir == "" {
+		return name
+	}
+	return filepath.Join(d.dir, name)
+}
+
+func (d dirFS) Open(name string) (io.ReadCloser, error) {
+	return d.fs.Open(d.path(name))
+}
+
+func (d dirFS) Create(name string) (io.WriteCloser, error) {
+	return d.fs.Create(d.path(name))
+}
+
+func (d dirFS) Access(name string, write bool) error {
+	return d.fs.Access(d.path(name), write)
+}
@@ -0,0 +1,119 @@
+package docopt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serve starts a server on a socket in a temporary directory.
+func serve(t *testing.T, s *Server) string {
+	socket := filepath.Join(t.TempDir(), "naval.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("no Unix sockets:", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go s.Serve(l)
+	return socket
+}
+
+func TestForward(t *testing.T) {
+	s := &Server{
+		Doc:    navalFate,
+		Parser: Parser{Help: true, Version: "Naval Fate 2.0"},
+		Handler: func(c *Call) {
+			fmt.Fprintf(c.Stdout, "%s moves to %s,%s\n", c.Args["<name>"], c.Args["<x>"], c.Args["<y>"])
+			fmt.Fprintf(c.Stderr, "speed %s in %s as %s\n", c.Args["--speed"], c.Dir, c.Env["NAVAL_USER"])
+			c.Exit(3)
+		},
+	}
+	socket := serve(t, s)
+	setenv(t, "NAVAL_USER", "captain")
+	setenv(t, "NAVAL_SECRET", "hidden")
+	dir, _ := os.Getwd()
+
+	var stdout, stderr bytes.Buffer
+	code, err := Forward(socket, []string{"ship", "Guardian", "move", "1", "2"}, []string{"NAVAL_USER"}, &stdout, &stderr)
+	if err != nil || code != 3 || stdout.String() != "[Guardian] moves to 1,2\n" ||
+		stderr.String() != "speed 10 in "+dir+" as captain\n" {
+		t.Errorf("%d %v %q %q", code, err, stdout.String(), stderr.String())
+	}
+}
+
+func TestForwardHelpAndErrorsLikeParseArgs(t *testing.T) {
+	parser := Parser{Help: true, Version: "Naval Fate 2.0"}
+	socket := serve(t, &Server{Doc: navalFate, Parser: parser, Handler: func(c *Call) {
+		t.Error("handler called")
+	}})
+	for _, tc := range []struct {
+		argv []string
+		code int
+	}{
+		{[]string{"--help"}, 0},
+		{[]string{"--version"}, 0},
+		{[]string{"ship", "Guardian", "move", "1", "2", "--sped=3"}, 2},
+		{[]string{}, 2},
+	} {
+		var localOut, localErr, stdout, stderr bytes.Buffer
+		local := parser
+		local.Stdout, local.Stderr, local.NoPager = &localOut, &localErr, true
+		local.ParseArgs(navalFate, tc.argv)
+
+		code, err := Forward(socket, tc.argv, nil, &stdout, &stderr)
+		if err != nil || code != tc.code || stdout.String() != localOut.String() || stderr.String() != localErr.String() {
+			t.Errorf("%v: %d %v %q %q", tc.argv, code, err, stdout.String(), stderr.String())
+		}
+	}
+
+	socket = serve(t, &Server{Doc: "Usage: prog (<a>"})
+	var stdout, stderr bytes.Buffer
+	code, err := Forward(socket, []string{"x"}, nil, &stdout, &stderr)
+	if err != nil || code != 1 || stderr.Len() == 0 {
+		t.Error(code, err, stderr.String())
+	}
+}
+
+func TestForwardHandlerPanic(t *testing.T) {
+	calls := 0
+	socket := serve(t, &Server{Doc: navalFate, Handler: func(c *Call) {
+		calls++
+		if calls == 1 {
+			panic("sunk")
+		}
+	}})
+	argv := []string{"ship", "Guardian", "move", "1", "2"}
+	var stdout, stderr bytes.Buffer
+	code, err := Forward(socket, argv, nil, &stdout, &stderr)
+	if err != nil || code != 1 || stderr.String() != "panic: sunk\n" {
+		t.Errorf("%d %v %q", code, err, stderr.String())
+	}
+	// the server still runs
+	if code, err := Forward(socket, argv, nil, &stdout, &stderr); err != nil || code != 0 {
+		t.Error(code, err)
+	}
+}
+
+func TestForwardOpensFilesInClientDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "orders.txt"), []byte("sail"), 0o644)
+	socket := serve(t, &Server{
+		Doc: "Usage: prog <orders>\n\nArguments:\n  <orders>  [type: infile]",
+		Handler: func(c *Call) {
+			b, _ := io.ReadAll(c.Args["<orders>"].(io.Reader))
+			c.Stdout.Write(b)
+		},
+	})
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	var stdout, stderr bytes.Buffer
+	code, err := Forward(socket, []string{"orders.txt"}, nil, &stdout, &stderr)
+	if err != nil || code != 0 || stdout.String() != "sail" {
+		t.Error(code, err, stdout.String(), stderr.String())
+	}
+}
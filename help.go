@@ -0,0 +1,180 @@
+package docopt
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// HelpFuncs are functions for help templates, to align columns by the
+// width the text takes on a terminal rather than by its length:
+//
+//	width "速度"         4, the DisplayWidth
+//	pad 8 "速度"         "速度    ", padded with spaces to 8 columns
+//
+// Add them to a template before parsing it:
+//
+//	template.New("help").Funcs(docopt.HelpFuncs).Parse(...)
+var HelpFuncs = template.FuncMap{
+	"width": DisplayWidth,
+	"pad":   pad,
+}
+
+// pad returns s followed by spaces up to width columns.
+func pad(width int, s string) string {
+	if n := width - DisplayWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+// HelpData is what Parser.HelpTemplate is executed with.
+type HelpData struct {
+	Prog    string // program name, from the usage section
+	Version string // Parser.Version
+	Doc     string // the doc as it is
+
+	// Usage holds the usage patterns, one per line.
+	Usage []string
+	// Groups are the "options:" sections, such as "Options:" or
+	// "Advanced options:", in the order of the doc.
+	Groups []HelpGroup
+	// Commands are the commands of the usage patterns in order of first
+	// appearance, described by the "commands:" section if there is one.
+	Commands []HelpCommand
+	// Sections are the other paragraphs of the doc.
+	Sections []HelpSection
+}
+
+// HelpGroup is an "options:" section of the doc.
+type HelpGroup struct {
+	Title   string // "Options", "Advanced options"
+	Options []HelpOption
+}
+
+// HelpOption is an entry of an "options:" section.
+type HelpOption struct {
+	Short       string // "-s"
+	Long        string // "--speed"
+	Argument    string // "<kn>", or empty for flags
+	Default     string // from "[default: ...]"
+	Description string // with lines joined by spaces
+}
+
+// HelpCommand is a command of the usage patterns. Default is set for the
+// command used when argv names none.
+type HelpCommand struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// HelpSection is a paragraph of the doc. Title is set if the first line
+// ends with a colon, like "Examples:", and Text holds the rest.
+type HelpSection struct {
+	Title string
+	Text  string
+}
+
+// helpText returns what --help prints: the doc, or HelpTemplate executed on
+// the HelpData of doc.
+func (p *Parser) helpText(doc string) (string, error) {
+	if p.HelpTemplate == nil {
+		return strings.Trim(p.markDefault(doc), "\n"), nil
+	}
+	data, err := p.Describe(doc)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := p.HelpTemplate.Execute(&b, data); err != nil {
+		return "", newError("help template: %s", err)
+	}
+	return strings.Trim(b.String(), "\n"), nil
+}
+
+var reParagraphs = regexp.MustCompile(`\n[ \t]*\n`)
+
+// Describe returns the HelpData of doc, for help templates and tools.
+func (p *Parser) Describe(doc string) (*HelpData, error) {
+	c, err := p.compile(doc, p.Limits.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	p, doc, syntax := c.parser, c.doc, c.syntax
+	data := &HelpData{Version: p.Version, Doc: doc}
+	data.Prog, data.Usage = relevantUsage(c.usage, nil, syntax)
+
+	for _, section := range parseSection("options:", doc) {
+		title, _, _ := stringPartition(section, ":")
+		group := HelpGroup{Title: strings.TrimSpace(title)}
+		for _, description := range syntax.sectionOptions(section) {
+			group.Options = append(group.Options, syntax.helpOption(description))
+		}
+		data.Groups = append(data.Groups, group)
+	}
+
+	descriptions := map[string]string{}
+	for _, section := range parseSection("commands:", doc) {
+		_, _, section = stringPartition(section, ":")
+		for _, line := range strings.Split(section, "\n") {
+			name, _, description := stringPartition(strings.TrimSpace(line), "  ")
+			descriptions[name] = strings.TrimSpace(reDefaultMark.ReplaceAllString(description, ""))
+		}
+	}
+	def, err := p.defaultCommand(doc, c.pat)
+	if err != nil {
+		return nil, c.locate(err)
+	}
+	commands, _ := c.pat.flat(patternCommand)
+	for _, c := range commands.unique() {
+		data.Commands = append(data.Commands, HelpCommand{c.name, descriptions[c.name], c.name == def})
+	}
+
+	for _, paragraph := range reParagraphs.Split(strings.Trim(doc, "\n"), -1) {
+		first, _, rest := stringPartition(paragraph, "\n")
+		lower := strings.ToLower(first)
+		if strings.Contains(lower, "usage:") || strings.Contains(lower, "options:") || strings.Contains(lower, "commands:") {
+			continue
+		}
+		if t := strings.TrimSpace(first); strings.HasSuffix(t, ":") {
+			data.Sections = append(data.Sections, HelpSection{strings.TrimSuffix(t, ":"), strings.Trim(rest, "\n")})
+		} else {
+			data.Sections = append(data.Sections, HelpSection{"", strings.Trim(paragraph, "\n")})
+		}
+	}
+	return data, nil
+}
+
+// helpOption describes an entry of an "options:" section.
+func (syntax OptionSyntax) helpOption(description string) HelpOption {
+	o := syntax.parseOption(description)
+	h := HelpOption{Short: o.short, Long: o.long}
+	if s, ok := o.value.(string); ok && o.argcount > 0 {
+		h.Default = s
+	}
+	names, _, text := stringPartition(strings.TrimSpace(description), "  ")
+	names = strings.Replace(names, ",", " ", -1)
+	names = strings.Replace(names, "=", " ", -1)
+	for _, s := range strings.Fields(names) {
+		if !syntax.isOption(s) {
+			h.Argument = s
+			break
+		}
+	}
+	h.Description = strings.Join(strings.Fields(text), " ")
+	return h
+}
+
+// Tree returns the pattern that argv is matched against, one node per line
+// and indented by depth, for tools that explain a doc.
+func (p *Parser) Tree(doc string) (string, error) {
+	c, err := p.compile(doc, p.Limits.withDefaults())
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	c.pat.tree(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
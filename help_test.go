@@ -0,0 +1,123 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+const helpDoc = `Naval Fate.
+
+Usage:
+  naval_fate ship new <name>...
+  naval_fate ship <name> move <x> <y> [--speed=<kn>]
+  naval_fate -h | --help
+
+Commands:
+  ship  Command a ship.
+  new   Launch a new ship.
+
+Options:
+  -h --help     Show this screen.
+  --speed=<kn>  Speed in knots
+                [default: 10].
+
+Advanced options:
+  -c, --crew <n>  Crew size.
+
+Examples:
+  naval_fate ship new Guardian`
+
+func TestHelpData(t *testing.T) {
+	data, err := (&Parser{Version: "2.0"}).Describe(helpDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &HelpData{
+		Prog:    "naval_fate",
+		Version: "2.0",
+		Doc:     helpDoc,
+		Usage: []string{
+			"naval_fate ship new <name>...",
+			"naval_fate ship <name> move <x> <y> [--speed=<kn>]",
+			"naval_fate -h | --help",
+		},
+		Groups: []HelpGroup{
+			{"Options", []HelpOption{
+				{"-h", "--help", "", "", "Show this screen."},
+				{"", "--speed", "<kn>", "10", "Speed in knots [default: 10]."},
+			}},
+			{"Advanced options", []HelpOption{
+				{"-c", "--crew", "<n>", "", "Crew size."},
+			}},
+		},
+		Commands: []HelpCommand{
+			{"ship", "Command a ship.", false},
+			{"new", "Launch a new ship.", false},
+			{"move", "", false},
+		},
+		Sections: []HelpSection{
+			{"", "Naval Fate."},
+			{"Examples", "  naval_fate ship new Guardian"},
+		},
+	}
+	if !reflect.DeepEqual(data, expect) {
+		t.Errorf("%#v", data)
+	}
+}
+
+func TestHelpTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("help").Parse(`{{.Prog}} {{.Version}}
+{{range .Commands}}{{.Name}}: {{.Description}}
+{{end}}{{range .Groups}}{{range .Options}}{{.Long}}={{.Default}}
+{{end}}{{end}}`))
+	p := &Parser{Help: true, Version: "2.0", HelpTemplate: tmpl}
+	_, output, err := p.parse(helpDoc, []string{"--help"})
+	expect := "naval_fate 2.0\nship: Command a ship.\nnew: Launch a new ship.\nmove: \n--help=\n--speed=10\n--crew="
+	if err != nil || output != expect {
+		t.Errorf("%q %v", output, err)
+	}
+
+	p.HelpTemplate = template.Must(template.New("help").Parse(`{{.Nope}}`))
+	if _, _, err = p.parse(helpDoc, []string{"--help"}); err == nil {
+		t.Error("expected template error")
+	}
+
+	// without a template the doc is printed as it is
+	if _, output, _ = (&Parser{Help: true}).parse(helpDoc, []string{"-h"}); output != helpDoc {
+		t.Errorf("%q", output)
+	}
+}
+
+func TestHelpFuncs(t *testing.T) {
+	doc := `Usage: prog [options]
+
+Options:
+  --speed=<速度>  速度を設定する。
+  --名前=<n>      Name of the ship.`
+	tmpl := template.Must(template.New("help").Funcs(HelpFuncs).Parse(
+		`{{range .Groups}}{{range .Options}}{{pad 16 (print .Long "=" .Argument)}}|{{.Description}} ({{width .Description}})
+{{end}}{{end}}`))
+	p := &Parser{Help: true, HelpTemplate: tmpl}
+	_, output, err := p.parse(doc, []string{"--help"})
+	expect := "--speed=<速度>  |速度を設定する。 (16)\n--名前=<n>      |Name of the ship. (17)"
+	if err != nil || output != expect {
+		t.Errorf("%q %v", output, err)
+	}
+}
+
+func TestTree(t *testing.T) {
+	tree, err := (&Parser{}).Tree("Usage: prog [options] (go|stop)\n\nOptions:\n  -v  Verbose.")
+	expect := `required
+  optionsshortcut
+    option(-v, , 0, false)
+  either
+    command(go, false)
+    command(stop, false)`
+	if err != nil || tree != expect {
+		t.Errorf("%s %v", tree, err)
+	}
+	if _, err := (&Parser{}).Tree("Usage: prog (go"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,346 @@
+package docopt
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ImportHelp converts the `--help` output of a program, or the SYNOPSIS and
+// OPTIONS sections of its man page as text, into a first draft of a doc: a
+// usage section and an Options section that parseOption understands. GNU
+// forms such as `-o, --output=FILE` and `--color[=WHEN]` become
+// `-o, --output=<file>` and `--color=<when>`, and defaults given in the
+// description become `[default: ...]`. Notes list what could not be
+// translated as it is, by line of text.
+func ImportHelp(text string) (doc string, notes []string) {
+	lines := strings.Split(reOverstrike.ReplaceAllString(strings.ReplaceAll(text, "\r\n", "\n"), ""), "\n")
+	im := &importer{}
+	usage, region := im.helpUsage(lines)
+	if sections := manSections(lines); sections != nil {
+		usage = im.synopsis(sections["SYNOPSIS"])
+		region = append(sections["DESCRIPTION"], sections["OPTIONS"]...)
+	}
+	if len(usage) == 0 {
+		im.note(0, "no usage found; the draft has `prog [options]`")
+		usage = []string{"prog [options]"}
+	}
+	im.options(region)
+
+	var b strings.Builder
+	b.WriteString("Usage:\n")
+	for _, u := range usage {
+		b.WriteString("  " + u + "\n")
+	}
+	if len(im.entries) > 0 {
+		b.WriteString("\nOptions:\n")
+		width := 0
+		for _, e := range im.entries {
+			if w := DisplayWidth(e.spec); w > width && w <= 28 {
+				width = w
+			}
+		}
+		indent := strings.Repeat(" ", width+4)
+		for _, e := range im.entries {
+			if len(e.description) == 0 {
+				b.WriteString("  " + e.spec + "\n")
+				continue
+			}
+			if DisplayWidth(e.spec) > width {
+				b.WriteString("  " + e.spec + "\n" + indent + e.description[0] + "\n")
+			} else {
+				b.WriteString("  " + e.spec + strings.Repeat(" ", width+2-DisplayWidth(e.spec)) + e.description[0] + "\n")
+			}
+			for _, d := range e.description[1:] {
+				b.WriteString(indent + d + "\n")
+			}
+		}
+	}
+	doc = b.String()
+	if err := (&Parser{}).Check(doc); err != nil {
+		im.note(0, "the draft does not parse: %s", err)
+	}
+	return doc, im.notes
+}
+
+var (
+	reOverstrike = regexp.MustCompile(".\x08")
+	reManSection = regexp.MustCompile(`^[A-Z][A-Z ]*$`)
+	reHelpUsage  = regexp.MustCompile(`(?i)^\s*usage:\s*(.*)$`)
+	reHelpOr     = regexp.MustCompile(`(?i)^\s+or:\s*(.*)$`)
+	reUpperWord  = regexp.MustCompile(`(^|[^-\w<])([A-Z][A-Z0-9_-]*)\b`)
+	reOptionsRef = regexp.MustCompile(`\[(?i:options?)\](?:\.\.\.)?`)
+	reDefault    = regexp.MustCompile(`(?i)\(default(?::\s*([^)]+)|\s+([^)\s]+))\)|\bdefaults?(?: value)?(?: is| to|:)\s+('[^']*'|"[^"]*"|[^\s;,)]+?)[.;,)]?(?:\s|$)`)
+)
+
+// importer collects the options and notes of ImportHelp.
+type importer struct {
+	entries []*importEntry
+	notes   []string
+	seen    map[string]bool
+}
+
+// importEntry is an option of the draft: its docopt spec and the lines of
+// its description.
+type importEntry struct {
+	spec        string
+	argument    bool
+	description []string
+}
+
+// importLine is a line of text with its number, from 1.
+type importLine struct {
+	n    int
+	text string
+}
+
+func (im *importer) note(n int, msg string, f ...interface{}) {
+	msg = fmt.Sprintf(msg, f...)
+	if n > 0 {
+		msg = fmt.Sprintf("line %d: %s", n, msg)
+	}
+	im.notes = append(im.notes, msg)
+}
+
+// manSections returns the lines of each section of a man page by heading, or
+// nil if text has neither a SYNOPSIS nor an OPTIONS heading.
+func manSections(lines []string) map[string][]importLine {
+	sections := map[string][]importLine{}
+	heading := ""
+	for i, line := range lines {
+		if reManSection.MatchString(line) {
+			heading = strings.TrimSpace(line)
+			sections[heading] = []importLine{}
+			continue
+		}
+		if heading != "" {
+			sections[heading] = append(sections[heading], importLine{i + 1, line})
+		}
+	}
+	if sections["SYNOPSIS"] == nil && sections["OPTIONS"] == nil {
+		return nil
+	}
+	return sections
+}
+
+// helpUsage returns the usage lines of `--help` output, converted, and the
+// lines after them.
+func (im *importer) helpUsage(lines []string) ([]string, []importLine) {
+	region := []importLine{}
+	for i, line := range lines {
+		region = append(region, importLine{i + 1, line})
+	}
+	for i, line := range region {
+		m := reHelpUsage.FindStringSubmatch(line.text)
+		if m == nil {
+			continue
+		}
+		synopsis := []importLine{{line.n, "  " + m[1]}}
+		j := i + 1
+		for ; j < len(region) && strings.TrimSpace(region[j].text) != ""; j++ {
+			if m := reHelpOr.FindStringSubmatch(region[j].text); m != nil {
+				synopsis = append(synopsis, importLine{region[j].n, "  " + m[1]})
+			} else if strings.HasPrefix(region[j].text, " ") && !strings.HasPrefix(strings.TrimSpace(region[j].text), "-") {
+				synopsis = append(synopsis, importLine{region[j].n, "    " + region[j].text})
+			} else {
+				break
+			}
+		}
+		return im.synopsis(synopsis), region[j:]
+	}
+	return nil, region
+}
+
+// synopsis converts usage lines, joining lines indented past the first to
+// the one before.
+func (im *importer) synopsis(lines []importLine) []string {
+	usage := []string{}
+	indent := -1
+	for _, line := range lines {
+		text := strings.TrimSpace(line.text)
+		if text == "" {
+			continue
+		}
+		n := len(line.text) - len(strings.TrimLeft(line.text, " \t"))
+		if indent < 0 {
+			indent = n
+		}
+		u := im.usageLine(line.n, text)
+		if n > indent && len(usage) > 0 {
+			usage[len(usage)-1] += " " + u
+		} else {
+			usage = append(usage, u)
+		}
+	}
+	return usage
+}
+
+// usageLine converts a usage line: the program name loses its directory,
+// `[OPTION]...` becomes `[options]` and upper-case words become arguments.
+func (im *importer) usageLine(n int, text string) string {
+	prog, _, rest := stringPartition(text, " ")
+	prog = path.Base(prog)
+	rest = reOptionsRef.ReplaceAllString(rest, "[options]")
+	rest = reUpperWord.ReplaceAllStringFunc(rest, func(s string) string {
+		m := reUpperWord.FindStringSubmatch(s)
+		return m[1] + "<" + strings.ToLower(m[2]) + ">"
+	})
+	if strings.ContainsAny(rest, "{},") {
+		im.note(n, "%q: braces and commas have no docopt form; use ( | ) alternatives", text)
+	}
+	return strings.TrimSpace(prog + " " + rest)
+}
+
+// options reads the option entries of region: lines starting with `-`, with
+// their description after two spaces or on the lines below, indented more.
+func (im *importer) options(region []importLine) {
+	im.seen = map[string]bool{}
+	var entry *importEntry
+	indent, column := 0, 0
+	for _, line := range region {
+		text := strings.TrimSpace(line.text)
+		if text == "" {
+			continue
+		}
+		n := len(line.text) - len(strings.TrimLeft(line.text, " \t"))
+		isOption := strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+")
+		if entry != nil && n > indent && (column == 0 || n >= column) && (!isOption || column > 0) {
+			if column == 0 {
+				column = n
+			}
+			if strings.HasPrefix(text, "-") && len(entry.description) > 0 {
+				entry.description[len(entry.description)-1] += " " + text
+			} else {
+				entry.description = append(entry.description, text)
+			}
+			continue
+		}
+		if entry != nil {
+			im.add(entry)
+			entry = nil
+		}
+		if !isOption {
+			continue
+		}
+		spec, description := text, ""
+		if i := strings.Index(text, "  "); i >= 0 {
+			spec, description = text[:i], strings.TrimSpace(text[i:])
+			column = n + strings.Index(text[i:], description) + i
+		} else {
+			column = 0
+		}
+		indent = n
+		converted, argument, ok := im.spec(line.n, spec)
+		if !ok {
+			continue
+		}
+		entry = &importEntry{spec: converted, argument: argument}
+		if description != "" {
+			entry.description = []string{description}
+		}
+	}
+	if entry != nil {
+		im.add(entry)
+	}
+}
+
+// add appends an entry, with the default its description gives if it takes
+// an argument.
+func (im *importer) add(e *importEntry) {
+	if e.argument {
+		description := strings.Join(e.description, " ")
+		if m := reDefault.FindStringSubmatch(description); m != nil && !strings.Contains(strings.ToLower(description), "[default:") {
+			value := strings.Trim(m[1]+m[2]+m[3], `'"`)
+			if len(e.description) == 0 {
+				e.description = []string{""}
+			}
+			e.description[len(e.description)-1] += " [default: " + value + "]"
+			e.description[len(e.description)-1] = strings.TrimSpace(e.description[len(e.description)-1])
+		}
+	}
+	im.entries = append(im.entries, e)
+}
+
+// spec converts the names of an option, such as `-o, --output=FILE`, to
+// docopt, and reports whether it takes an argument.
+func (im *importer) spec(n int, spec string) (string, bool, bool) {
+	short, long, argument := "", "", ""
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg := part, ""
+		switch {
+		case strings.HasPrefix(part, "--"):
+			if i := strings.IndexAny(part, "=[ "); i >= 0 {
+				name, arg = part[:i], part[i:]
+			}
+		case strings.HasPrefix(part, "-") && len(part) > 1:
+			name, arg = part[:2], part[2:]
+			if arg != "" && !strings.ContainsAny(arg[:1], " =[") {
+				if strings.ToLower(arg) == arg && !strings.HasPrefix(arg, "<") {
+					im.note(n, "%s: single-dash long options have no docopt form", part)
+					return "", false, false
+				}
+			}
+		default:
+			im.note(n, "%s: options not starting with - have no docopt form", part)
+			return "", false, false
+		}
+		if im.seen[name] {
+			im.note(n, "%s is described twice; the first is kept", name)
+			return "", false, false
+		}
+		if arg = strings.TrimSpace(arg); strings.HasPrefix(arg, "[") {
+			im.note(n, "%s: optional argument %s made required", part, arg)
+			arg = strings.Trim(arg, "[]")
+		}
+		if arg = strings.TrimLeft(arg, "= "); arg != "" {
+			converted := importArgument(arg)
+			if converted == "" {
+				im.note(n, "%s: argument %s has no docopt form; named <%s>", part, arg, strings.TrimLeft(name, "-"))
+				converted = "<" + strings.TrimLeft(name, "-") + ">"
+			}
+			argument = converted
+		}
+		switch {
+		case strings.HasPrefix(name, "--") && long == "":
+			long = name
+		case !strings.HasPrefix(name, "--") && short == "":
+			short = name
+		default:
+			im.note(n, "%s: docopt takes one short and one long name; %s is left out", spec, name)
+			continue
+		}
+		im.seen[name] = true
+	}
+	converted := short
+	switch {
+	case long != "" && short != "":
+		converted += ", " + long
+	case long != "":
+		converted = long
+	}
+	if argument != "" {
+		if long != "" {
+			converted += "=" + argument
+		} else {
+			converted += " " + argument
+		}
+	}
+	return converted, argument != "", converted != ""
+}
+
+var reArgumentName = regexp.MustCompile(`^<?([A-Za-z][\w-]*)>?(\.\.\.)?$`)
+
+// importArgument converts an argument name such as FILE to <file>, or
+// returns "" if it has no docopt form.
+func importArgument(arg string) string {
+	m := reArgumentName.FindStringSubmatch(arg)
+	if m == nil {
+		return ""
+	}
+	return "<" + strings.ToLower(m[1]) + ">"
+}
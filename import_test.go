@@ -0,0 +1,117 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+const lsHelp = `Usage: /bin/ls [OPTION]... [FILE]...
+List information about the FILEs (the current directory by default).
+
+Mandatory arguments to long options are mandatory for short options too.
+  -a, --all                  do not ignore entries starting with .
+      --block-size=SIZE      with -l, scale sizes by SIZE when printing them;
+                               e.g., '--block-size=M'; see SIZE format below
+      --color[=WHEN]         colorize the output; WHEN can be 'always' (default
+                               if omitted), 'auto', or 'never'
+  -I, --ignore=PATTERN       do not list implied entries matching shell PATTERN
+  -T, --tabsize=COLS         assume tab stops at each COLS (default: 8)
+  -w COLS                    set output width to COLS
+  -name                      not really ls
+
+Exit status:
+ 0  if OK,
+`
+
+func TestImportHelp(t *testing.T) {
+	doc, notes := ImportHelp(lsHelp)
+	expect := `Usage:
+  ls [options] [<file>]...
+
+Options:
+  -a, --all               do not ignore entries starting with .
+  --block-size=<size>     with -l, scale sizes by SIZE when printing them;
+                          e.g., '--block-size=M'; see SIZE format below
+  --color=<when>          colorize the output; WHEN can be 'always' (default
+                          if omitted), 'auto', or 'never'
+  -I, --ignore=<pattern>  do not list implied entries matching shell PATTERN
+  -T, --tabsize=<cols>    assume tab stops at each COLS (default: 8) [default: 8]
+  -w <cols>               set output width to COLS
+`
+	if doc != expect {
+		t.Errorf("%s", doc)
+	}
+	expectNotes := []string{
+		"line 8: --color[=WHEN]: optional argument [=WHEN] made required",
+		"line 13: -name: single-dash long options have no docopt form",
+	}
+	if !reflect.DeepEqual(notes, expectNotes) {
+		t.Errorf("%q", notes)
+	}
+	v, err := (&Parser{}).ParseArgs(doc, []string{"-T4", "--color=never", "src"})
+	if err != nil || v["--tabsize"] != "4" || v["--color"] != "never" || !reflect.DeepEqual(v["<file>"], []string{"src"}) {
+		t.Error(v, err)
+	}
+}
+
+const cpMan = `CP(1)                        User Commands                       CP(1)
+
+NAME
+       cp - copy files and directories
+
+SYNOPSIS
+       cp [OPTION]... [-T] SOURCE DEST
+       cp [OPTION]... SOURCE... DIRECTORY
+
+DESCRIPTION
+       Copy SOURCE to DEST, or multiple SOURCE(s) to DIRECTORY.
+
+       -b     like --backup but does not accept an argument
+
+       -S, --suffix=SUFFIX
+              override the usual backup suffix
+
+       --sparse=WHEN
+              control creation of sparse files; defaults to auto.
+
+       -t, --target-directory={DIR}
+              copy all SOURCE arguments into DIRECTORY
+`
+
+func TestImportManPage(t *testing.T) {
+	doc, notes := ImportHelp(cpMan)
+	expect := `Usage:
+  cp [options] [-T] <source> <dest>
+  cp [options] <source>... <directory>
+
+Options:
+  -b                     like --backup but does not accept an argument
+  -S, --suffix=<suffix>  override the usual backup suffix
+  --sparse=<when>        control creation of sparse files; defaults to auto. [default: auto]
+  -t, --target-directory=<target-directory>
+                         copy all SOURCE arguments into DIRECTORY
+`
+	if doc != expect {
+		t.Errorf("%s", doc)
+	}
+	expectNotes := []string{
+		"line 21: --target-directory={DIR}: argument {DIR} has no docopt form; named <target-directory>",
+	}
+	if !reflect.DeepEqual(notes, expectNotes) {
+		t.Errorf("%q", notes)
+	}
+}
+
+func TestImportHelpDisplayWidth(t *testing.T) {
+	doc, _ := ImportHelp("Usage: tool [OPTION]...\n  -l, --言語=LANG  出力の言語\n  -v, --verbose  詳しく表示する\n")
+	expect := `Usage:
+  tool [options]
+
+Options:
+  -l, --言語=<lang>  出力の言語
+  -v, --verbose      詳しく表示する
+`
+	if doc != expect {
+		t.Errorf("%s", doc)
+	}
+}
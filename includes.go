@@ -0,0 +1,103 @@
+package docopt
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// includePrefix starts a line of the doc replaced by a fragment, such as
+//
+//	#include common-options.txt
+//
+// The fragment is looked up in Parser.Fragments by name, or else read from
+// Parser.Includes, and may include others in turn. Names in a fragment are
+// relative to its directory, as `#include` lines of a C file are: in
+// "opts/common.txt", `#include log.txt` includes "opts/log.txt". Unless
+// either is set, such lines are text like any other.
+const includePrefix = "#include "
+
+// origin is where a line of a doc with its includes expanded comes from.
+type origin struct {
+	file string // "" for the doc itself
+	line int
+}
+
+// include returns doc with its includes expanded, and the origin of each
+// line of the result.
+func (p *Parser) include(doc string, limits Limits) (string, []origin, error) {
+	lines, origins := []string{}, []origin{}
+	size := 0
+	expanding := len(p.Fragments) > 0 || p.Includes != nil
+	var expand func(file, text string, stack []string) error
+	expand = func(file, text string, stack []string) error {
+		for i, line := range strings.Split(text, "\n") {
+			at := origin{file, i + 1}
+			trimmed := strings.TrimSpace(line)
+			if !expanding || !strings.HasPrefix(trimmed, includePrefix) {
+				size += len(line) + 1
+				if limits.exceeded(limits.DocSize, size-1) {
+					return newLimitError("DocSize", "doc is longer than %d bytes with its includes", limits.DocSize)
+				}
+				lines, origins = append(lines, line), append(origins, at)
+				continue
+			}
+			name := strings.TrimSpace(strings.TrimPrefix(trimmed, includePrefix))
+			if file != "" {
+				name = path.Join(path.Dir(file), name)
+			}
+			for j, s := range stack {
+				if s == name {
+					err := newLanguageError("include cycle: %s -> %s", strings.Join(stack[j:], " -> "), name)
+					return at.locate(err)
+				}
+			}
+			fragment, err := p.fragment(name)
+			if err != nil {
+				return at.locate(newLanguageError("cannot include %s: %s", name, err))
+			}
+			if err := expand(name, strings.TrimSuffix(fragment, "\n"), append(stack, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := expand("", doc, nil); err != nil {
+		return "", nil, err
+	}
+	return strings.Join(lines, "\n"), origins, nil
+}
+
+// fragment returns the text included by name.
+func (p *Parser) fragment(name string) (string, error) {
+	if fragment, ok := p.Fragments[name]; ok {
+		return fragment, nil
+	}
+	if p.Includes == nil {
+		return "", fs.ErrNotExist
+	}
+	b, err := fs.ReadFile(p.Includes, name)
+	if err != nil {
+		if e, ok := err.(*fs.PathError); ok {
+			err = e.Err
+		}
+		return "", err
+	}
+	return string(b), nil
+}
+
+// locate sets the position of a LanguageError.
+func (at origin) locate(err error) error {
+	if e, ok := err.(*LanguageError); ok {
+		e.File, e.Line = at.file, at.line
+	}
+	return err
+}
+
+func (at origin) String() string {
+	if at.file == "" {
+		return fmt.Sprintf("line %d", at.line)
+	}
+	return fmt.Sprintf("%s:%d", at.file, at.line)
+}
@@ -0,0 +1,110 @@
+package docopt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+const includesDoc = `Usage: deploy [options] <service>
+
+Options:
+  --dry-run  Show what would be done.
+#include common-options.txt
+`
+
+var commonOptions = fstest.MapFS{
+	"common-options.txt": {Data: []byte(`  -v, --verbose        Say more.
+#include config.txt
+  --log-format=<fmt>   Format of logs [default: text].
+`)},
+	"config.txt": {Data: []byte("  --config=<file>      Configuration file.\n")},
+}
+
+func TestIncludes(t *testing.T) {
+	p := &Parser{Includes: commonOptions}
+	v, err := p.ParseArgs(includesDoc, []string{"-v", "--config=c.toml", "web"})
+	expect := map[string]interface{}{"--dry-run": false, "--verbose": true, "--config": "c.toml", "--log-format": "text", "<service>": "web"}
+	if err != nil || !reflect.DeepEqual(v, expect) {
+		t.Error(v, err)
+	}
+
+	// fragments come first, and help shows them expanded
+	var out bytes.Buffer
+	p = &Parser{Help: true, Stdout: &out, NoPager: true, Includes: commonOptions,
+		Fragments: map[string]string{"config.txt": "  --config=<file>      Settings."}}
+	p.ParseArgs(includesDoc, []string{"--help"})
+	if !bytes.Contains(out.Bytes(), []byte("\n  --config=<file>      Settings.\n  --log-format")) {
+		t.Error(out.String())
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		fsys fstest.MapFS
+		err  string
+		line int
+	}{
+		{fstest.MapFS{}, "cannot include common-options.txt: file does not exist", 5},
+		{fstest.MapFS{
+			"common-options.txt": {Data: []byte("  -v  Say more.\n#include config.txt")},
+			"config.txt":         {Data: []byte("#include common-options.txt")},
+		}, "config.txt:1: include cycle: common-options.txt -> config.txt -> common-options.txt", 1},
+		{fstest.MapFS{
+			"common-options.txt": {Data: []byte("  -v  Say more.\n  --log-format=<fmt>  [type: bogus]")},
+		}, "common-options.txt:2: unknown type for --log-format: bogus", 2},
+		{fstest.MapFS{
+			"common-options.txt": {Data: []byte("  -v  Say more. [counter: v bogus=1]")},
+		}, "common-options.txt:1: -v: unknown setting bogus of counter v", 1},
+	} {
+		_, err := (&Parser{Includes: tc.fsys}).ParseArgs(includesDoc, []string{"web"})
+		if e, ok := err.(*LanguageError); !ok || e.Error() != tc.err || e.Line != tc.line {
+			t.Errorf("%v, want %s", err, tc.err)
+		}
+	}
+
+	// errors in the usage are on its lines, in Describe and Tree too
+	p := &Parser{Fragments: map[string]string{"usage.txt": "  deploy <service>\n  deploy (--all"}}
+	doc := "Usage:\n#include usage.txt\n"
+	if _, err := p.Describe(doc); err == nil || err.Error() != "usage.txt:2: unmatched '(', expected: ')' got: ''" {
+		t.Error(err)
+	}
+	if _, err := p.Tree(doc); err == nil || err.Error() != "usage.txt:2: unmatched '(', expected: ')' got: ''" {
+		t.Error(err)
+	}
+	if _, err := p.Tree("Usage: deploy\n  deploy --all]"); err == nil || err.(*LanguageError).Line != 2 {
+		t.Error(err)
+	}
+}
+
+func TestNestedIncludes(t *testing.T) {
+	p := &Parser{Includes: fstest.MapFS{
+		"opts/common.txt": {Data: []byte("  -v  Say more.\n#include log.txt")},
+		"opts/log.txt":    {Data: []byte("  --log=<file>  Log file.")},
+	}}
+	doc := "Usage: prog [options]\n\nOptions:\n#include opts/common.txt\n"
+	v, err := p.ParseArgs(doc, []string{"--log=x"})
+	if err != nil || v["--log"] != "x" {
+		t.Error(v, err)
+	}
+}
+
+func TestIncludesOff(t *testing.T) {
+	doc := `Usage: cc [options] <file>
+
+Compiles C files, such as one starting with
+#include <stdio.h>
+
+Options:
+  -O  Optimize.`
+	var out bytes.Buffer
+	p := &Parser{Help: true, Stdout: &out, NoPager: true}
+	if v, err := p.ParseArgs(doc, []string{"-O", "a.c"}); err != nil || v["<file>"] != "a.c" {
+		t.Error(v, err)
+	}
+	p.ParseArgs(doc, []string{"--help"})
+	if out.String() != doc+"\n" {
+		t.Errorf("%q", out.String())
+	}
+}
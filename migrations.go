@@ -0,0 +1,201 @@
+package docopt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Migration rewrites argv of an old version of a program to the current
+// one. From and To are words and `<placeholders>`; a last placeholder in From
+// followed by `...` takes all remaining words:
+//
+//	Migration{From: "ship new <name>...", To: "fleet add <name>..."}
+//
+// In a doc, the same rules are lines of a "migrations:" section:
+//
+//	Migrations:
+//	  ship new <name>...  ->  fleet add <name>...
+//	  ship <name> move    ->  fleet move <name>
+//
+// From is matched against the words of argv that are not options; options
+// in between are kept and follow the new words, with the rest of argv.
+type Migration struct {
+	From string
+	To   string
+}
+
+// migrations returns the migrations of the parser, then those of doc.
+func (p *Parser) migrations(doc string) ([]Migration, error) {
+	migrations := append([]Migration{}, p.Migrations...)
+	at := make([]int, len(migrations)) // offsets of their lines in doc
+	for i := range at {
+		at[i] = -1
+	}
+	sections, offsets := sectionsAt("migrations:", doc)
+	for i, section := range sections {
+		title, _, section := stringPartition(section, ":")
+		offset := offsets[i] + len(title) + 1
+		for _, line := range strings.Split(section, "\n") {
+			lineOffset := offset + len(line) - len(strings.TrimLeft(line, " \t"))
+			offset += len(line) + 1
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			from, arrow, to := stringPartition(line, "->")
+			if arrow == "" {
+				return nil, errorAt(newLanguageError("migration without \"->\": %s", strings.TrimSpace(line)), lineOffset)
+			}
+			migrations = append(migrations, Migration{strings.TrimSpace(from), strings.TrimSpace(to)})
+			at = append(at, lineOffset)
+		}
+	}
+	for i, m := range migrations {
+		bound := map[string]bool{}
+		for _, word := range strings.Fields(m.From) {
+			bound[strings.TrimSuffix(word, "...")] = true
+		}
+		for _, word := range strings.Fields(m.To) {
+			if isPlaceholder(word) && !bound[strings.TrimSuffix(word, "...")] {
+				return nil, errorAt(newLanguageError("migration %s -> %s: %s is not in %s", m.From, m.To, word, m.From), at[i])
+			}
+		}
+	}
+	return migrations, nil
+}
+
+func isPlaceholder(word string) bool {
+	word = strings.TrimSuffix(word, "...")
+	return strings.HasPrefix(word, "<") && strings.HasSuffix(word, ">")
+}
+
+// migrate returns argv rewritten by the first migration that applies to it.
+// The arguments of options are told from other words by options.
+func (syntax OptionSyntax) migrate(migrations []Migration, argv []string, options patternList) ([]string, bool) {
+	for _, m := range migrations {
+		if rewritten, ok := syntax.apply(m, argv, options); ok {
+			return rewritten, true
+		}
+	}
+	return nil, false
+}
+
+// apply rewrites argv by m, if it applies.
+func (syntax OptionSyntax) apply(m Migration, argv []string, options patternList) ([]string, bool) {
+	from := strings.Fields(m.From)
+	values := map[string][]string{}
+	kept := []string{}
+	i := 0
+	// option moves past the option at i of argv and its argument
+	option := func() {
+		n := syntax.optionWords(argv[i], options)
+		if i+n > len(argv) {
+			n = len(argv) - i
+		}
+		kept = append(kept, argv[i:i+n]...)
+		i += n
+	}
+	for _, word := range from {
+		for i < len(argv) && syntax.isOption(argv[i]) {
+			option()
+		}
+		if strings.HasSuffix(word, "...") && isPlaceholder(word) {
+			name := strings.TrimSuffix(word, "...")
+			for i < len(argv) && argv[i] != "--" {
+				if syntax.isOption(argv[i]) {
+					option()
+				} else {
+					values[name] = append(values[name], argv[i])
+					i++
+				}
+			}
+			if len(values[name]) == 0 {
+				return nil, false
+			}
+			continue
+		}
+		if i >= len(argv) || argv[i] == "--" {
+			return nil, false
+		}
+		if isPlaceholder(word) {
+			values[word] = []string{argv[i]}
+		} else if word != argv[i] {
+			return nil, false
+		}
+		i++
+	}
+	rewritten := []string{}
+	for _, word := range strings.Fields(m.To) {
+		if isPlaceholder(word) {
+			rewritten = append(rewritten, values[strings.TrimSuffix(word, "...")]...)
+		} else {
+			rewritten = append(rewritten, word)
+		}
+	}
+	rewritten = append(rewritten, kept...)
+	return append(rewritten, argv[i:]...), true
+}
+
+// optionWords returns the number of words of argv that the option arg
+// takes: 2 if its argument is the next word, 1 otherwise.
+func (syntax OptionSyntax) optionWords(arg string, options patternList) int {
+	// find returns the only option that matches, if there is one
+	find := func(match func(o *pattern) bool) *pattern {
+		var found *pattern
+		for _, o := range options {
+			if match(o) {
+				if found != nil && found.name != o.name {
+					return nil
+				}
+				found = o
+			}
+		}
+		return found
+	}
+	switch {
+	case syntax.isLong(arg):
+		long, eq, _ := stringPartition(arg, "=")
+		o := find(func(o *pattern) bool { return o.long == long })
+		if o == nil {
+			o = find(func(o *pattern) bool { return strings.HasPrefix(o.long, long) })
+		}
+		if eq == "" && o != nil && o.argcount > 0 {
+			return 2
+		}
+	case syntax.isShort(arg):
+		rest := strings.TrimPrefix(arg, syntax.Short)
+		for j, r := range rest {
+			short := syntax.Short + string(r)
+			if o := find(func(o *pattern) bool { return o.short == short }); o != nil && o.argcount > 0 {
+				if j+utf8.RuneLen(r) == len(rest) {
+					return 2
+				}
+				break
+			}
+		}
+	}
+	return 1
+}
+
+// deprecated reports that argv was migrated to rewritten: through the
+// Deprecated hook, or as a warning on stderr.
+func (p *Parser) deprecated(prog string, argv, rewritten []string) {
+	if p.Deprecated != nil {
+		p.Deprecated(argv, rewritten)
+		return
+	}
+	fmt.Fprintf(p.stderr(), "%s: warning: %s is deprecated, use %s\n",
+		prog, commandLine(prog, argv), commandLine(prog, rewritten))
+}
+
+// commandLine quotes prog and argv for a shell.
+func commandLine(prog string, argv []string) string {
+	words := []string{prog}
+	for _, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+			arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
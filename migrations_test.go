@@ -0,0 +1,86 @@
+package docopt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const fleetDoc = `Naval Fate 3.
+
+Usage:
+  naval_fate fleet add <name>... [--speed=<kn>]
+  naval_fate fleet move <name> <x> <y>
+
+Migrations:
+  ship new <name>...    ->  fleet add <name>...
+  ship <name> move      ->  fleet move <name>`
+
+func TestMigrations(t *testing.T) {
+	var stderr bytes.Buffer
+	p := &Parser{Stderr: &stderr}
+	v, err := p.ParseArgs(fleetDoc, []string{"ship", "new", "Guardian", "--speed=20", "Black Pearl"})
+	expect := map[string]interface{}{"fleet": true, "add": true, "move": false, "<name>": []string{"Guardian", "Black Pearl"},
+		"<x>": nil, "<y>": nil, "--speed": "20"}
+	if err != nil || !reflect.DeepEqual(v, expect) {
+		t.Error(v, err)
+	}
+	if s := stderr.String(); s != "naval_fate: warning: naval_fate ship new Guardian --speed=20 'Black Pearl' is deprecated, "+
+		"use naval_fate fleet add Guardian 'Black Pearl' --speed=20\n" {
+		t.Errorf("%q", s)
+	}
+
+	// the arguments of options are not taken for placeholders
+	v, err = (&Parser{Stderr: &stderr}).ParseArgs(fleetDoc, []string{"ship", "new", "--speed", "20", "Guardian"})
+	if err != nil || !reflect.DeepEqual(v["<name>"], []string{"Guardian"}) || v["--speed"] != "20" {
+		t.Error(v, err)
+	}
+	if rewritten, _ := defaultSyntax.migrate([]Migration{{"ship <name> move", "fleet move <name>"}}, []string{"ship", "-s", "20", "Guardian", "move"},
+		patternList{newOption("-s", "--speed", 1, nil), newOption("-v", "", 0, false)}); !reflect.DeepEqual(rewritten, []string{"fleet", "move", "Guardian", "-s", "20"}) {
+		t.Error(rewritten)
+	}
+
+	var old, rewritten []string
+	p = &Parser{Deprecated: func(a, b []string) { old, rewritten = a, b }}
+	v, err = p.ParseArgs(fleetDoc, []string{"ship", "Guardian", "move", "1", "2"})
+	if err != nil || v["move"] != true || v["<name>"].([]string)[0] != "Guardian" {
+		t.Error(v, err)
+	}
+	if !reflect.DeepEqual(old, []string{"ship", "Guardian", "move", "1", "2"}) ||
+		!reflect.DeepEqual(rewritten, []string{"fleet", "move", "Guardian", "1", "2"}) {
+		t.Error(old, rewritten)
+	}
+
+	// the current usage is not rewritten, and argv no migration fixes fails
+	old = nil
+	if _, err = p.ParseArgs(fleetDoc, []string{"fleet", "add", "Guardian"}); err != nil || old != nil {
+		t.Error(old, err)
+	}
+	if _, _, err = p.parse(fleetDoc, []string{"ship", "sink", "Guardian"}); err == nil || old != nil {
+		t.Error(old, err)
+	}
+}
+
+func TestGoMigrationsAndShowMigration(t *testing.T) {
+	p := &Parser{
+		Migrations:    []Migration{{From: "launch <name>", To: "fleet add <name>"}},
+		ShowMigration: true,
+	}
+	args, output, err := p.parse(fleetDoc, []string{"launch", "Guardian"})
+	if args != nil || err != nil || output != "naval_fate fleet add Guardian" {
+		t.Errorf("%v %q %v", args, output, err)
+	}
+}
+
+func TestMigrationLanguageErrors(t *testing.T) {
+	for _, doc := range []string{
+		"Usage: prog go\n\nMigrations:\n  run  go",
+		"Usage: prog go <x>\n\nMigrations:\n  run  ->  go <x>",
+	} {
+		if _, _, err := (&Parser{}).parse(doc, []string{"go"}); err == nil {
+			t.Errorf("no error for %q", doc)
+		} else if _, ok := err.(*LanguageError); !ok {
+			t.Errorf("%q: %v", doc, err)
+		}
+	}
+}
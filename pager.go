@@ -0,0 +1,82 @@
+package docopt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// defaultPager is used when neither Parser.Pager nor $PAGER are set.
+const defaultPager = "less -FRX"
+
+// printHelp prints the output of `--help` or `--version`, through the pager
+// if it does not fit on the terminal.
+func (p *Parser) printHelp(output string) {
+	if cmd, ok := p.pager(output); ok {
+		if err := page(cmd, output, p.stdout(), p.stderr()); err == nil {
+			return
+		}
+	}
+	fmt.Fprintln(p.stdout(), output)
+}
+
+// pager returns the pager command for output, and whether to use it.
+func (p *Parser) pager(output string) (string, bool) {
+	if p.NoPager || os.Getenv("DOCOPT_NO_PAGER") != "" {
+		return "", false
+	}
+	terminal := p.Terminal
+	if terminal == nil {
+		terminal = func() (int, bool) { return terminalHeight(p.stdout()) }
+	}
+	height, ok := terminal()
+	if !ok || strings.Count(output, "\n")+1 < height {
+		return "", false
+	}
+	cmd := p.Pager
+	if cmd == "" {
+		cmd = os.Getenv("PAGER")
+	}
+	if cmd == "" {
+		cmd = defaultPager
+	}
+	return cmd, true
+}
+
+// page runs cmd with the shell to show output on stdout. It fails only if
+// the pager could not be started: once it runs, it may have shown output
+// whatever its exit status.
+func page(cmd, output string, stdout, stderr io.Writer) error {
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = strings.NewReader(output + "\n")
+	c.Stdout = stdout
+	c.Stderr = stderr
+	if err := c.Start(); err != nil {
+		return err
+	}
+	c.Wait()
+	return nil
+}
+
+// terminalHeight reports whether w is a terminal, and its height: the size
+// of its window, or else $LINES, or else 24 lines.
+func terminalHeight(w io.Writer) (int, bool) {
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return 0, false
+	}
+	if rows := windowHeight(f); rows > 0 {
+		return rows, true
+	}
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 0 {
+		return lines, true
+	}
+	return 24, true
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package docopt
+
+import "os"
+
+// windowHeight returns 0: the window size of f is not known here.
+func windowHeight(f *os.File) int {
+	return 0
+}
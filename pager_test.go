@@ -0,0 +1,115 @@
+package docopt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func terminal(height int, ok bool) func() (int, bool) {
+	return func() (int, bool) { return height, ok }
+}
+
+// setenv sets an environment variable for the rest of the test.
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestPagerChoice(t *testing.T) {
+	setenv(t, "DOCOPT_NO_PAGER", "")
+	setenv(t, "PAGER", "more")
+
+	p := &Parser{Terminal: terminal(3, true)}
+	if cmd, ok := p.pager("a\nb\nc"); !ok || cmd != "more" {
+		t.Error(cmd, ok)
+	}
+	if _, ok := p.pager("a\nb"); ok {
+		t.Error("short help was paged")
+	}
+	p.Pager = "most"
+	if cmd, _ := p.pager("a\nb\nc"); cmd != "most" {
+		t.Error(cmd)
+	}
+	os.Setenv("PAGER", "")
+	p.Pager = ""
+	if cmd, _ := p.pager("a\nb\nc"); cmd != defaultPager {
+		t.Error(cmd)
+	}
+
+	if _, ok := (&Parser{Terminal: terminal(0, false)}).pager("a\nb\nc"); ok {
+		t.Error("paged without a terminal")
+	}
+	if _, ok := (&Parser{Terminal: terminal(3, true), NoPager: true}).pager("a\nb\nc"); ok {
+		t.Error("paged with NoPager")
+	}
+	os.Setenv("DOCOPT_NO_PAGER", "1")
+	if _, ok := (&Parser{Terminal: terminal(3, true)}).pager("a\nb\nc"); ok {
+		t.Error("paged with $DOCOPT_NO_PAGER")
+	}
+}
+
+func TestPagerRunsCommand(t *testing.T) {
+	setenv(t, "DOCOPT_NO_PAGER", "")
+	out := filepath.Join(t.TempDir(), "help")
+	p := &Parser{Help: true, Terminal: terminal(2, true), Pager: "cat > " + out}
+	if _, err := p.ParseArgs(navalFate, []string{"--help"}); err != nil {
+		t.Fatal(err)
+	}
+	paged, err := os.ReadFile(out)
+	if err != nil || string(paged) != navalFate+"\n" {
+		t.Errorf("%q %v", paged, err)
+	}
+}
+
+func TestTerminalHeight(t *testing.T) {
+	// a character device without a window falls back to $LINES, then 24
+	f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	setenv(t, "LINES", "40")
+	if height, ok := terminalHeight(f); height != 40 || !ok {
+		t.Error(height, ok)
+	}
+	os.Setenv("LINES", "")
+	if height, ok := terminalHeight(f); height != 24 || !ok {
+		t.Error(height, ok)
+	}
+	if _, ok := terminalHeight(&bytes.Buffer{}); ok {
+		t.Error("a buffer is a terminal")
+	}
+}
+
+func TestPagerFailure(t *testing.T) {
+	setenv(t, "DOCOPT_NO_PAGER", "")
+	// a pager that fails after it started has shown what it could: the help
+	// is not printed again, and its errors go to Stderr
+	var stdout, stderr bytes.Buffer
+	p := &Parser{Help: true, Terminal: terminal(2, true), Stdout: &stdout, Stderr: &stderr,
+		Pager: "head -n 1; echo broken >&2; exit 3"}
+	p.ParseArgs(navalFate, []string{"--help"})
+	if stdout.String() != "Naval Fate.\n" || stderr.String() != "broken\n" {
+		t.Errorf("%q %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestParseArgsPrintsToStdoutAndStderr(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	p := &Parser{Help: true, Stdout: &stdout, Stderr: &stderr, NoPager: true}
+	p.ParseArgs(navalFate, []string{"--help"})
+	p.ParseArgs(navalFate, []string{"--sped"})
+	if stdout.String() != navalFate+"\n" || !strings.HasPrefix(stderr.String(), "naval_fate: error: unknown option --sped\n") {
+		t.Errorf("%q %q", stdout.String(), stderr.String())
+	}
+}
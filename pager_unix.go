@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package docopt
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// windowHeight returns the number of rows of the terminal f, or 0 if it can
+// not tell.
+func windowHeight(f *os.File) int {
+	var size struct{ rows, cols, xpixels, ypixels uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0
+	}
+	return int(size.rows)
+}
@@ -0,0 +1,87 @@
+package docopt
+
+// loosened returns a copy of p with every Required made Optional, so that
+// matching it takes what it can of argv. Leaves are shared with p.
+func (p *pattern) loosened() *pattern {
+	if p.t&patternBranch == 0 {
+		return p
+	}
+	q := *p
+	if q.t == patternRequired {
+		q.t = patternOptionAL
+	}
+	q.children = make(patternList, len(p.children))
+	for i, child := range p.children {
+		q.children[i] = child.loosened()
+	}
+	return &q
+}
+
+// partial sets the partial result of e from argv, the part of the command
+// line that could be parsed; the words of rest, after it, are left over.
+// Matching takes at most maxSteps steps in all, and fails with a LimitError.
+func (p *Parser) partial(e *UserError, pat *pattern, argv patternList, rest, unknown []string, abbrev map[int]string, maxSteps int) error {
+	fold := p.fold()
+	partial, leftover, err := partialMatch(pat, argv, unknown, func() *matcher {
+		m := newMatcher(argv, nil)
+		m.maxSteps, m.fold, m.abbrev = maxSteps, fold, abbrev
+		return m
+	})
+	if err != nil {
+		return err
+	}
+	e.Partial, e.Leftover = partial, append(leftover, rest...)
+	return nil
+}
+
+// partialMatch matches as much of argv as it can on the closest usage
+// pattern of pat, for a UserError: the one that takes the most commands, and
+// then the most of argv. It returns the commands, arguments and options
+// recognized, and the words left over: arguments that fit nowhere and
+// unknown options. The alternatives share the step budget of one matcher,
+// and matching fails with its LimitError.
+func partialMatch(pat *pattern, argv patternList, unknown []string, newMatcher func() *matcher) (Opts, []string, error) {
+	alternatives := patternList{pat}
+	if len(pat.children) == 1 && pat.children[0].t&patternEither != 0 {
+		alternatives = pat.children[0].children
+	}
+	var best *matcher
+	bestCommands, steps := 0, 0
+	for _, alternative := range alternatives {
+		m := newMatcher()
+		m.steps = steps
+		m.match(alternative.loosened())
+		steps = m.steps
+		if m.err != nil {
+			return nil, nil, m.err
+		}
+		commands := 0
+		for _, c := range m.collected {
+			if c.t&patternCommand != 0 && c.value == true {
+				commands++
+			}
+		}
+		if best == nil || commands > bestCommands || commands == bestCommands && m.left < best.left {
+			best, bestCommands = m, commands
+		}
+	}
+
+	isUnknown := map[string]bool{}
+	for _, name := range unknown {
+		isUnknown[name] = true
+	}
+	recognized := best.collected
+	leftover := []string{}
+	for i, a := range argv {
+		switch {
+		case best.consumed[i]:
+		case a.t&patternOption != 0 && !isUnknown[a.name]:
+			recognized = append(recognized, a)
+		case a.t&patternOption != 0:
+			leftover = append(leftover, a.name)
+		default:
+			leftover = append(leftover, a.value.(string))
+		}
+	}
+	return Opts(recognized.dictionary()), leftover, nil
+}
@@ -0,0 +1,79 @@
+package docopt
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPartialResults(t *testing.T) {
+	_, _, err := (&Parser{}).parse(navalFate, []string{"ship", "Guardian", "move", "1", "--speed=20", "--sped"})
+	e, ok := err.(*UserError)
+	if !ok {
+		t.Fatal(err)
+	}
+	expect := Opts{"ship": true, "<name>": []string{"Guardian"}, "move": true, "<x>": "1", "--speed": "20"}
+	if !reflect.DeepEqual(e.Partial, expect) || !reflect.DeepEqual(e.Leftover, []string{"--sped"}) {
+		t.Errorf("%v %q", e.Partial, e.Leftover)
+	}
+
+	_, _, err = (&Parser{}).parse(navalFate, []string{"mine", "set", "1", "2", "3", "--moored"})
+	e = err.(*UserError)
+	expect = Opts{"mine": true, "set": true, "<x>": "1", "<y>": "2", "--moored": true}
+	if !reflect.DeepEqual(e.Partial, expect) || !reflect.DeepEqual(e.Leftover, []string{"3"}) {
+		t.Errorf("%v %q", e.Partial, e.Leftover)
+	}
+
+	// the partial match is bounded by Steps too
+	_, _, err = (&Parser{Limits: Limits{Steps: 5}}).parse("usage: prog a b c d e", []string{"x"})
+	if e, ok := err.(*LimitError); !ok || e.Limit != "Steps" {
+		t.Error(err)
+	}
+
+	// so are argv that can not be parsed, up to the word that fails
+	for _, tc := range []struct {
+		argv     []string
+		expect   Opts
+		leftover []string
+	}{
+		{[]string{"ship", "Guardian", "move", "1", "--speed"},
+			Opts{"ship": true, "<name>": []string{"Guardian"}, "move": true, "<x>": "1"}, []string{"--speed"}},
+		{[]string{"mine", "set", "1", "2", "--mo"},
+			Opts{"mine": true, "set": true, "<x>": "1", "<y>": "2"}, []string{"--mo"}},
+		{[]string{"mine", "set", "1", "--moored=yes", "2"},
+			Opts{"mine": true, "set": true, "<x>": "1"}, []string{"--moored=yes", "2"}},
+	} {
+		_, _, err = (&Parser{}).parse(navalFate+"\n  --moon  Moon.", tc.argv)
+		e, ok := err.(*UserError)
+		if !ok || !reflect.DeepEqual(e.Partial, tc.expect) || !reflect.DeepEqual(e.Leftover, tc.leftover) {
+			t.Errorf("%v: %v %v %q", tc.argv, err, e.Partial, e.Leftover)
+		}
+	}
+
+	// success is unchanged
+	v, err := (&Parser{}).ParseArgs(navalFate, []string{"mine", "set", "1", "2"})
+	if err != nil || v["mine"] != true || len(v) != 15 {
+		t.Error(len(v), v, err)
+	}
+}
+
+func TestPartialResultsShareSteps(t *testing.T) {
+	doc := "Usage:\n"
+	for i := 0; i < 20; i++ {
+		doc += fmt.Sprintf("  prog cmd%02d <x>\n", i)
+	}
+	c, err := (&Parser{}).compile(doc, DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argv := patternList{newArgument("", "nope")}
+	// enough steps for any one alternative, not for all of them
+	err = (&Parser{}).partial(&UserError{}, c.pat, argv, nil, nil, nil, 20)
+	if e, ok := err.(*LimitError); !ok || e.Limit != "Steps" {
+		t.Error(err)
+	}
+	e := &UserError{}
+	if err := (&Parser{}).partial(e, c.pat, argv, []string{"rest"}, nil, nil, 0); err != nil || !reflect.DeepEqual(e.Leftover, []string{"rest"}) {
+		t.Error(err, e.Leftover)
+	}
+}
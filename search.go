@@ -0,0 +1,118 @@
+package docopt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helpKeyword returns the keyword of `--help <keyword>`, `-h <keyword>` or
+// `--help-search <keyword>` in argv, for Parser.Help.
+func helpKeyword(argv patternList) (string, bool) {
+	for i, o := range argv {
+		if o.t&patternOption == 0 {
+			continue
+		}
+		if s, ok := o.value.(string); ok && o.name == "--help-search" {
+			return s, true
+		}
+		if o.value != true || o.name != "-h" && o.name != "--help" && o.name != "--help-search" {
+			continue
+		}
+		if i+1 < len(argv) && argv[i+1].t&patternArgument != 0 {
+			if s, ok := argv[i+1].value.(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// searchHelp returns the parts of the help that mention keyword, in any
+// case: the usage lines, and the entries of the "options:" and "commands:"
+// sections, with their options, commands, descriptions or section titles.
+// They keep the formatting of the doc; the rest of it is left out.
+func (p *Parser) searchHelp(doc, keyword string) string {
+	doc = p.markDefault(doc)
+	syntax := p.Syntax.withDefaults()
+	lower := strings.ToLower(keyword)
+	matches := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), lower)
+	}
+
+	found := []string{}
+	for _, usage := range parseSection("usage:", doc) {
+		lines := strings.Split(usage, "\n")
+		title, _, first := stringPartition(lines[0], ":")
+		kept := []string{title + ":"}
+		if strings.TrimSpace(first) != "" && matches(first) {
+			kept[0] = lines[0]
+		}
+		for _, line := range lines[1:] {
+			if matches(line) {
+				kept = append(kept, line)
+			}
+		}
+		if len(kept) > 1 || kept[0] != title+":" {
+			found = append(found, strings.Join(kept, "\n"))
+		}
+	}
+
+	isOption := func(line string) bool {
+		return syntax.isOption(strings.TrimSpace(line))
+	}
+	optionText := func(entry string) string {
+		o := syntax.parseOption(entry)
+		return o.short + " " + o.long + " " + entry
+	}
+	for _, section := range parseSection("options:", doc) {
+		found = append(found, searchSection(section, matches, isOption, optionText)...)
+	}
+	indent := func(line string) int { return len(line) - len(strings.TrimLeft(line, " \t")) }
+	for _, section := range parseSection("commands:", doc) {
+		first := -1
+		isCommand := func(line string) bool {
+			if first < 0 || indent(line) <= first {
+				first = indent(line)
+				return true
+			}
+			return false
+		}
+		found = append(found, searchSection(section, matches, isCommand, nil)...)
+	}
+
+	if len(found) == 0 {
+		return fmt.Sprintf("No help matches %q.", keyword)
+	}
+	return strings.Join(found, "\n\n")
+}
+
+// searchSection returns section whole if its title matches, or its title
+// and the entries that match. Entries start at lines for which isEntry is
+// true; text, if not nil, is what an entry is matched on.
+func searchSection(section string, matches func(string) bool, isEntry func(string) bool, text func(string) string) []string {
+	lines := strings.Split(section, "\n")
+	if matches(lines[0]) {
+		return []string{section}
+	}
+	entries := [][]string{}
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) != "" && isEntry(line) || len(entries) == 0 {
+			entries = append(entries, []string{})
+		}
+		entries[len(entries)-1] = append(entries[len(entries)-1], line)
+	}
+	kept := []string{lines[0]}
+	for _, entry := range entries {
+		s := strings.Join(entry, "\n")
+		if text != nil {
+			s = text(s)
+		}
+		if matches(s) {
+			kept = append(kept, strings.TrimRight(strings.Join(entry, "\n"), "\n "))
+		}
+	}
+	if len(kept) == 1 {
+		return nil
+	}
+	return []string{strings.Join(kept, "\n")}
+}
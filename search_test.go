@@ -0,0 +1,39 @@
+package docopt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSearchHelp(t *testing.T) {
+	for _, tc := range []struct {
+		argv   []string
+		expect string
+	}{
+		{[]string{"--help", "SPEED"}, `Usage:
+  naval_fate ship <name> move <x> <y> [--speed=<kn>]
+
+Options:
+  --speed=<kn>  Speed in knots
+                [default: 10].`},
+		{[]string{"--help-search", "new"}, `Usage:
+  naval_fate ship new <name>...
+
+Commands:
+  new   Launch a new ship.`},
+		{[]string{"-h", "advanced"}, `Advanced options:
+  -c, --crew <n>  Crew size.`},
+		{[]string{"--help-search=crew"}, `Advanced options:
+  -c, --crew <n>  Crew size.`},
+		{[]string{"--help", "torpedo"}, `No help matches "torpedo".`},
+	} {
+		var out bytes.Buffer
+		p := &Parser{Help: true, Stdout: &out, NoPager: true}
+		if _, err := p.ParseArgs(helpDoc, tc.argv); err != nil {
+			t.Error(tc.argv, err)
+		}
+		if out.String() != tc.expect+"\n" {
+			t.Errorf("%v: %q", tc.argv, out.String())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package docopt
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// OptionSyntax describes how options are spelled, both in the doc and in
+// argv, for tools that do not follow the GNU conventions.
+//
+// For `find -name` or `java -classpath` style options, set Long to "-": every
+// option is then long, and options can not be clustered. For X toolkit style
+// `-sb`/`+sb` pairs, also set Negate to "+".
+type OptionSyntax struct {
+	// Long is the prefix of long options, "--" if empty.
+	Long string
+	// Short is the prefix of single-character options that can be
+	// clustered, "-" if empty. There are no short options if it is the same
+	// as Long.
+	Short string
+	// Negate, if not empty, is a prefix that turns a flag off: `+sb` sets
+	// `-sb` to false. Flags that can be negated are nil unless given.
+	Negate string
+}
+
+var defaultSyntax = OptionSyntax{Long: "--", Short: "-"}
+
+func (s OptionSyntax) withDefaults() OptionSyntax {
+	if s.Long == "" {
+		s.Long = defaultSyntax.Long
+	}
+	if s.Short == "" {
+		s.Short = defaultSyntax.Short
+	}
+	return s
+}
+
+func (s OptionSyntax) hasShorts() bool {
+	return s.Short != s.Long
+}
+
+// isLong reports whether tok is a long option; "--" alone never is one.
+func (s OptionSyntax) isLong(tok string) bool {
+	return strings.HasPrefix(tok, s.Long) && tok != s.Long && tok != "--"
+}
+
+func (s OptionSyntax) isShort(tok string) bool {
+	return s.hasShorts() && strings.HasPrefix(tok, s.Short) && tok != s.Short &&
+		tok != "--" && !s.isLong(tok) && !s.isStrayLong(tok)
+}
+
+// isStrayLong reports whether tok is spelled like a GNU long option while
+// long options start with something else, such as `--foo` when Long is "/".
+// It is not a cluster of short options.
+func (s OptionSyntax) isStrayLong(tok string) bool {
+	return s.Long != "--" && strings.HasPrefix(tok, "--") && tok != "--" && !s.isLong(tok)
+}
+
+func (s OptionSyntax) isNegated(tok string) bool {
+	return s.Negate != "" && strings.HasPrefix(tok, s.Negate) && tok != s.Negate &&
+		!s.isLong(tok) && !s.isShort(tok)
+}
+
+func (s OptionSyntax) isOption(tok string) bool {
+	return s.isLong(tok) || s.isShort(tok) || s.isNegated(tok)
+}
+
+// unnegate returns the short or long spelling of the negated option tok.
+func (s OptionSyntax) unnegate(tok string) (short, long string) {
+	name := strings.TrimPrefix(tok, s.Negate)
+	if s.hasShorts() && utf8.RuneCountInString(name) == 1 {
+		return s.Short + name, ""
+	}
+	return "", s.Long + name
+}
+
+// prefixPattern returns a regular expression matching any option prefix.
+func (s OptionSyntax) prefixPattern() string {
+	prefixes := []string{regexp.QuoteMeta(s.Long)}
+	if s.hasShorts() {
+		prefixes = append(prefixes, regexp.QuoteMeta(s.Short))
+	}
+	if s.Negate != "" {
+		prefixes = append(prefixes, regexp.QuoteMeta(s.Negate))
+	}
+	return "(?:" + strings.Join(prefixes, "|") + ")"
+}
+
+func parseNegated(tokens *tokenList, options *patternList) (patternList, error) {
+	// negated ::= negate chars ;
+	tok := tokens.move().String()
+	short, long := tokens.syntax.unnegate(tok)
+	similar := patternList{}
+	for _, o := range *options {
+		if short != "" && o.short == short || long != "" && o.long == long {
+			similar = append(similar, o)
+		}
+	}
+	if len(similar) > 1 {
+		return nil, tokens.errorFunc("%s is specified ambiguously %d times", tok, len(similar))
+	}
+	if len(similar) < 1 {
+		if tokens.err == errorUser {
+			return nil, tokens.errorFunc("%s is not an option that can be negated", tok)
+		}
+		opt := newOption(short, long, 0, false)
+		opt.negatable = true
+		*options = append(*options, opt)
+		similar = patternList{opt}
+	}
+	if similar[0].argcount > 0 {
+		return nil, tokens.errorFunc("%s takes an argument and can not be negated", tok)
+	}
+	similar[0].negatable = true
+	opt := newOption(similar[0].short, similar[0].long, 0, similar[0].value)
+	opt.negatable = true
+	if tokens.err == errorUser {
+		opt.value = false
+	}
+	return patternList{opt}, nil
+}
+
+// negatableNames returns the names of the options that can be negated.
+func negatableNames(options patternList) map[string]bool {
+	names := make(map[string]bool)
+	for _, o := range options {
+		if o.negatable {
+			names[o.name] = true
+		}
+	}
+	return names
+}
+
+// markNegatable makes the flags in pl that are named in names negatable, so
+// that they are nil rather than false unless given.
+func markNegatable(pl patternList, names map[string]bool) {
+	for _, o := range pl {
+		if o.t == patternOption && o.argcount == 0 && names[o.name] {
+			o.negatable = true
+			if o.value == false {
+				o.value = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSingleDashLongOptions(t *testing.T) {
+	doc := `Usage: find <path>... [-name <pattern>] [-type <t>] [-print]
+
+Options:
+  -name <pattern>  Base of file name matches shell pattern.
+  -type <t>        File is of type t [default: f].
+  -print           Print the full file name.`
+	p := &Parser{Syntax: OptionSyntax{Long: "-"}}
+	v, err := p.ParseArgs(doc, []string{".", "src", "-name", "*.go", "-print"})
+	w := map[string]interface{}{"<path>": []string{".", "src"}, "-name": "*.go", "-type": "f", "-print": true}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+
+	// options are not clustered, but can still be abbreviated
+	_, err = p.ParseArgs(doc, []string{".", "-np"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+	v, err = p.ParseArgs(doc, []string{".", "-na=x", "-"})
+	w = map[string]interface{}{"<path>": []string{".", "-"}, "-name": "x", "-type": "f", "-print": false}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+
+	doc = "Usage: java [-cp=<path> | -classpath=<path>] <class>"
+	v, err = p.ParseArgs(doc, []string{"-classpath", "lib", "Main"})
+	w = map[string]interface{}{"-cp": nil, "-classpath": "lib", "<class>": "Main"}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+}
+
+func TestNegatedOptions(t *testing.T) {
+	doc := `Usage: xterm [-sb | +sb] [-ls] [-geometry <g>]
+
+Options:
+  -ls, +ls         Start a login shell.
+  -geometry <g>    Size and position of the window.`
+	p := &Parser{Syntax: OptionSyntax{Long: "-", Negate: "+"}}
+	v, err := p.ParseArgs(doc, []string{"+sb", "-ls", "-geometry", "80x24"})
+	w := map[string]interface{}{"-sb": false, "-ls": true, "-geometry": "80x24"}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+	v, err = p.ParseArgs(doc, []string{"-sb", "+ls"})
+	w = map[string]interface{}{"-sb": true, "-ls": false, "-geometry": nil}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+	v, err = p.ParseArgs(doc, []string{})
+	w = map[string]interface{}{"-sb": nil, "-ls": nil, "-geometry": nil}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+	_, err = p.ParseArgs(doc, []string{"+geometry"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+	_, err = p.ParseArgs(doc, []string{"+x"})
+	if _, ok := err.(*UserError); !ok {
+		t.Error(err)
+	}
+
+	// with GNU style options, single characters negate short options
+	p = &Parser{Syntax: OptionSyntax{Negate: "+"}}
+	v, err = p.ParseArgs("Usage: prog [-x | +x] [--color | +color]", []string{"+x", "+color"})
+	w = map[string]interface{}{"-x": false, "--color": false}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+	v, err = p.ParseArgs("Usage: prog [options]\n\nOptions:\n  -x, +x  Trace.", []string{"+x"})
+	if reflect.DeepEqual(v, map[string]interface{}{"-x": false}) != true {
+		t.Error(v, err)
+	}
+}
+
+func TestCustomOptionPrefixes(t *testing.T) {
+	doc := `Usage: prog [options] <file>
+
+Options:
+  /verbose      Be verbose.
+  /out <file>   Output file [default: a.out].
+  -q            Quiet.`
+	p := &Parser{Syntax: OptionSyntax{Long: "/"}}
+	v, err := p.ParseArgs(doc, []string{"/verbose", "/out=x", "-q", "in"})
+	w := map[string]interface{}{"/verbose": true, "/out": "x", "-q": true, "<file>": "in"}
+	if reflect.DeepEqual(v, w) != true {
+		t.Error(v, err)
+	}
+	// GNU style long options are not clusters of short ones
+	_, _, err = p.parse(doc, []string{"--verbose", "in"})
+	if e, ok := err.(*UserError); !ok || e.Error() != "unknown option --verbose: long options start with /" {
+		t.Error(err)
+	}
+	if _, err = p.ParseArgs("Usage: prog [--verbose]", []string{}); err == nil {
+		t.Error("--verbose accepted in the doc")
+	}
+
+	// the defaults still parse GNU style docs
+	v, err = (&Parser{}).ParseArgs("Usage: prog [-ab] [--all]", []string{"-ba", "--all"})
+	if reflect.DeepEqual(v, map[string]interface{}{"-a": true, "-b": true, "--all": true}) != true {
+		t.Error(v, err)
+	}
+}
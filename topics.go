@@ -0,0 +1,51 @@
+package docopt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// topicHelp returns the output for `help topics` or `help <topic>` when argv
+// is one of them and did not match the usage of the doc itself. It reports
+// whether argv asked for a topic.
+func (p *Parser) topicHelp(argv []string) (string, bool, error) {
+	if len(p.Topics) == 0 || len(argv) != 2 || argv[0] != "help" {
+		return "", false, nil
+	}
+	if argv[1] == "topics" {
+		return p.topicList(), true, nil
+	}
+	if topic, ok := p.Topics[argv[1]]; ok {
+		return strings.Trim(topic, "\n"), true, nil
+	}
+	return "", true, newUserError("unknown help topic %s, see 'help topics'", argv[1])
+}
+
+// topicNames returns the names of the help topics, sorted.
+func (p *Parser) topicNames() []string {
+	names := make([]string, 0, len(p.Topics))
+	for name := range p.Topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// topicList lists the help topics with the first line of each.
+func (p *Parser) topicList() string {
+	names := p.topicNames()
+	width := 0
+	for _, name := range names {
+		if n := DisplayWidth(name); n > width {
+			width = n
+		}
+	}
+	lines := []string{"Help topics:"}
+	for _, name := range names {
+		summary, _, _ := stringPartition(strings.TrimSpace(p.Topics[name]), "\n")
+		padding := strings.Repeat(" ", width-DisplayWidth(name))
+		lines = append(lines, strings.TrimRight(fmt.Sprintf("  %s%s  %s", name, padding, summary), " "))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,65 @@
+package docopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+var topics = map[string]string{
+	"configuration": `
+Configuration is read from ~/.navalrc.
+
+It may set the default speed.
+`,
+	"exit-codes": "Exit codes:\n  0  Success.\n  2  Usage error.",
+}
+
+func TestHelpTopics(t *testing.T) {
+	p := &Parser{Topics: topics}
+	args, output, err := p.parse(navalFate, []string{"help", "configuration"})
+	if args != nil || err != nil || output != "Configuration is read from ~/.navalrc.\n\nIt may set the default speed." {
+		t.Errorf("%v %q %v", args, output, err)
+	}
+
+	args, output, err = p.parse(navalFate, []string{"help", "topics"})
+	expect := `Help topics:
+  configuration  Configuration is read from ~/.navalrc.
+  exit-codes     Exit codes:`
+	if args != nil || err != nil || output != expect {
+		t.Errorf("%v %q %v", args, output, err)
+	}
+
+	_, output, err = p.parse(navalFate, []string{"help", "nope"})
+	if _, ok := err.(*UserError); !ok || err.Error() != "unknown help topic nope, see 'help topics'" || output == "" {
+		t.Error(err)
+	}
+
+	// without topics, `help` is just an argument that does not match
+	_, _, err = (&Parser{}).parse(navalFate, []string{"help", "topics"})
+	if _, ok := err.(*UserError); !ok || err.Error() != "" {
+		t.Error(err)
+	}
+}
+
+func TestHelpTopicsDoNotAffectUsage(t *testing.T) {
+	p := &Parser{Topics: topics}
+	v, err := p.ParseArgs("Usage: prog help <command>", []string{"help", "topics"})
+	if reflect.DeepEqual(v, map[string]interface{}{"help": true, "<command>": "topics"}) != true {
+		t.Error(v, err)
+	}
+	v, err = p.ParseArgs(navalFate, []string{"ship", "new", "help"})
+	if err != nil || v["new"] != true {
+		t.Error(v, err)
+	}
+}
+
+func TestHelpTopicsAlignWideNames(t *testing.T) {
+	p := &Parser{Topics: map[string]string{"設定": "設定ファイルについて。", "exit-codes": "Exit codes."}}
+	_, output, _ := p.parse(navalFate, []string{"help", "topics"})
+	expect := `Help topics:
+  exit-codes  Exit codes.
+  設定        設定ファイルについて。`
+	if output != expect {
+		t.Errorf("%q", output)
+	}
+}
@@ -0,0 +1,126 @@
+package docopt
+
+import "unicode"
+
+// DisplayWidth returns the number of terminal columns s takes: two for each
+// wide or fullwidth East Asian character, none for combining marks and other
+// zero-width characters, and one for the rest. Help is aligned with it.
+func DisplayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case unicode.IsControl(r), unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf), unicode.Is(zeroWidth, r):
+		return 0
+	case unicode.Is(wide, r):
+		return 2
+	}
+	return 1
+}
+
+// zeroWidth are the characters without a column of their own that are not
+// marks or format characters: Hangul medial vowels and final consonants.
+var zeroWidth = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1160, 0x11ff, 1},
+		{0xd7b0, 0xd7ff, 1},
+	},
+}
+
+// wide are the characters of East Asian Width W (wide) and F (fullwidth).
+var wide = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1}, // Hangul initial consonants
+		{0x231a, 0x231b, 1},
+		{0x2329, 0x232a, 1},
+		{0x23e9, 0x23ec, 1},
+		{0x23f0, 0x23f3, 3},
+		{0x25fd, 0x25fe, 1},
+		{0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1},
+		{0x267f, 0x2693, 20},
+		{0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26ab, 1},
+		{0x26bd, 0x26be, 1},
+		{0x26c4, 0x26c5, 1},
+		{0x26ce, 0x26d4, 6},
+		{0x26ea, 0x26ea, 1},
+		{0x26f2, 0x26f3, 1},
+		{0x26f5, 0x26fa, 5},
+		{0x26fd, 0x26fd, 1},
+		{0x2705, 0x2705, 1},
+		{0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1},
+		{0x274c, 0x274e, 2},
+		{0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1},
+		{0x2795, 0x2797, 1},
+		{0x27b0, 0x27bf, 15},
+		{0x2b1b, 0x2b1c, 1},
+		{0x2b50, 0x2b55, 5},
+		{0x2e80, 0x303e, 1}, // CJK radicals, punctuation, ideographic space
+		{0x3041, 0x33ff, 1}, // kana, bopomofo, CJK compatibility
+		{0x3400, 0x4dbf, 1}, // CJK extension A
+		{0x4e00, 0x9fff, 1}, // CJK unified ideographs
+		{0xa000, 0xa4cf, 1}, // Yi
+		{0xa960, 0xa97f, 1}, // Hangul extended A
+		{0xac00, 0xd7a3, 1}, // Hangul syllables
+		{0xf900, 0xfaff, 1}, // CJK compatibility ideographs
+		{0xfe10, 0xfe19, 1}, // vertical forms
+		{0xfe30, 0xfe6f, 1}, // CJK compatibility and small forms
+		{0xff00, 0xff60, 1}, // fullwidth forms
+		{0xffe0, 0xffe6, 1}, // fullwidth signs
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x16fe4, 1},
+		{0x17000, 0x18cff, 1}, // Tangut, Khitan
+		{0x1b000, 0x1b2ff, 1}, // kana supplement, Nushu
+		{0x1f004, 0x1f004, 1},
+		{0x1f0cf, 0x1f0cf, 1},
+		{0x1f18e, 0x1f18e, 1},
+		{0x1f191, 0x1f19a, 1},
+		{0x1f200, 0x1f202, 1},
+		{0x1f210, 0x1f23b, 1},
+		{0x1f240, 0x1f248, 1},
+		{0x1f250, 0x1f251, 1},
+		{0x1f260, 0x1f265, 1},
+		{0x1f300, 0x1f320, 1}, // emoji
+		{0x1f32d, 0x1f335, 1},
+		{0x1f337, 0x1f37c, 1},
+		{0x1f37e, 0x1f393, 1},
+		{0x1f3a0, 0x1f3ca, 1},
+		{0x1f3cf, 0x1f3d3, 1},
+		{0x1f3e0, 0x1f3f0, 1},
+		{0x1f3f4, 0x1f3f4, 1},
+		{0x1f3f8, 0x1f43e, 1},
+		{0x1f440, 0x1f440, 1},
+		{0x1f442, 0x1f4fc, 1},
+		{0x1f4ff, 0x1f53d, 1},
+		{0x1f54b, 0x1f54e, 1},
+		{0x1f550, 0x1f567, 1},
+		{0x1f57a, 0x1f57a, 1},
+		{0x1f595, 0x1f596, 1},
+		{0x1f5a4, 0x1f5a4, 1},
+		{0x1f5fb, 0x1f64f, 1},
+		{0x1f680, 0x1f6c5, 1},
+		{0x1f6cc, 0x1f6cc, 1},
+		{0x1f6d0, 0x1f6d2, 1},
+		{0x1f6d5, 0x1f6d7, 1},
+		{0x1f6dc, 0x1f6df, 1},
+		{0x1f6eb, 0x1f6ec, 1},
+		{0x1f6f4, 0x1f6fc, 1},
+		{0x1f7e0, 0x1f7eb, 1},
+		{0x1f7f0, 0x1f7f0, 1},
+		{0x1f90c, 0x1f93a, 1},
+		{0x1f93c, 0x1f945, 1},
+		{0x1f947, 0x1f9ff, 1},
+		{0x1fa70, 0x1faff, 1},
+		{0x20000, 0x2fffd, 1}, // CJK extensions B to F
+		{0x30000, 0x3fffd, 1}, // CJK extension G
+	},
+}
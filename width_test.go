@@ -0,0 +1,26 @@
+package docopt
+
+import "testing"
+
+func TestDisplayWidth(t *testing.T) {
+	for s, width := range map[string]int{
+		"":             0,
+		"--speed":      7,
+		"日本語":          6,
+		"速度を設定する":      14,
+		"中文说明":         8,
+		"한국어":          6,
+		"ＡＢＣ":          6,
+		"e\u0301":      1, // e and a combining acute accent
+		"\u1100\u1161": 2, // Hangul jamo forming one syllable
+		"a\u200db":     2, // zero width joiner
+		"\t":           0,
+		"🚢":            2,
+		"\xff":         1,
+		"<名前>":         6,
+	} {
+		if w := DisplayWidth(s); w != width {
+			t.Errorf("DisplayWidth(%q) = %d, want %d", s, w, width)
+		}
+	}
+}